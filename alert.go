@@ -0,0 +1,180 @@
+package ktw
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// GitHub alert types, and the prefix of the callout they are styled as.
+var alertTypes = map[string]string{
+	"NOTE":      "Note",
+	"TIP":       "Tip",
+	"IMPORTANT": "Info",
+	"WARNING":   "Warning",
+	"CAUTION":   "Danger",
+}
+
+// KindAlert is the NodeKind of an Alert.
+var KindAlert = ast.NewNodeKind("Alert")
+
+// Alert is a block node representing a GitHub-style alert, a blockquote that
+// starts with a line such as "[!NOTE]". Its children are those of the
+// blockquote, without the "[!NOTE]" line.
+type Alert struct {
+	ast.BaseBlock
+	Callout Callout
+}
+
+// Kind implements ast.Node.Kind.
+func (n *Alert) Kind() ast.NodeKind {
+	return KindAlert
+}
+
+// Dump implements ast.Node.Dump.
+func (n *Alert) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Class": n.Callout.Class}, nil)
+}
+
+// alerts implements the GitHub alert syntax as a Goldmark extension.
+type alerts struct {
+	callouts map[string]Callout
+}
+
+// NewAlerts returns a Goldmark extension that turns GitHub-style alerts,
+// blockquotes starting with a line such as "> [!NOTE]", into a "<div>"
+// styled the same way as the callout of the same name. The GitHub alert
+// types are mapped onto Note, Tip, Info, Warning and Danger callouts, and any
+// other callout can be used by name, such as "> [!SECURITY]".
+func NewAlerts(callouts map[string]Callout) goldmark.Extender {
+	return &alerts{callouts: callouts}
+}
+
+func (e *alerts) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithParagraphTransformers(
+			util.Prioritized(&alertParagraphTransformer{e}, 200),
+		),
+		parser.WithASTTransformers(
+			util.Prioritized(&alertASTTransformer{}, 200),
+		),
+	)
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(&calloutRenderer{}, 500),
+	))
+}
+
+// lookup returns the callout for the alert type (as in "[!type]").
+func (e *alerts) lookup(typ string) (Callout, bool) {
+	if typ == "" {
+		return Callout{}, false
+	}
+	if prefix, ok := alertTypes[strings.ToUpper(typ)]; ok {
+		if callout, ok := e.callouts[prefix]; ok {
+			return callout, true
+		}
+	}
+	for prefix, callout := range e.callouts {
+		if strings.EqualFold(prefix, typ) {
+			return callout, true
+		}
+	}
+	return Callout{}, false
+}
+
+var alertsKey = parser.NewContextKey()
+
+// pendingAlert is a blockquote found to be an alert, to be replaced by an
+// Alert once the document has been parsed.
+type pendingAlert struct {
+	node    *ast.Blockquote
+	callout Callout
+	label   string
+}
+
+// alertParagraphTransformer recognizes the "[!NOTE]" line at the start of a
+// blockquote. The blockquote itself is still being parsed at that point, so
+// it is only recorded and the line is removed.
+type alertParagraphTransformer struct {
+	alerts *alerts
+}
+
+func (t *alertParagraphTransformer) Transform(node *ast.Paragraph, reader text.Reader, pc parser.Context) {
+	quote, ok := node.Parent().(*ast.Blockquote)
+	if !ok || quote.FirstChild() != node || node.Lines().Len() == 0 {
+		return
+	}
+	first := node.Lines().At(0)
+	line := bytes.TrimSpace(first.Value(reader.Source()))
+	if !bytes.HasPrefix(line, []byte("[!")) || !bytes.HasSuffix(line, []byte("]")) {
+		return
+	}
+	callout, ok := t.alerts.lookup(string(line[2 : len(line)-1]))
+	if !ok {
+		return
+	}
+
+	// The label of an alert is its type, such as "Note" for "[!NOTE]".
+	typ := string(line[2 : len(line)-1])
+	label := strings.ToUpper(typ[:1]) + strings.ToLower(typ[1:])
+	pending, _ := pc.Get(alertsKey).([]pendingAlert)
+	pc.Set(alertsKey, append(pending, pendingAlert{node: quote, callout: callout, label: label}))
+
+	if node.Lines().Len() == 1 {
+		quote.RemoveChild(quote, node)
+		return
+	}
+	node.Lines().SetSliced(1, node.Lines().Len())
+}
+
+// alertASTTransformer replaces the blockquotes that were recognized as alerts
+// by an Alert.
+type alertASTTransformer struct{}
+
+func (t *alertASTTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	pending, _ := pc.Get(alertsKey).([]pendingAlert)
+	for _, p := range pending {
+		parent := p.node.Parent()
+		if parent == nil {
+			continue
+		}
+		alert := &Alert{Callout: p.callout}
+		alert.SetAttributeString("class", p.callout.Class)
+		if p.callout.Title != "" {
+			alert.SetAttributeString("title", p.callout.Title)
+		}
+		if p.callout.Icon != "" {
+			alert.SetAttributeString("data-icon", p.callout.Icon)
+		}
+		// The label of an alert is not part of its text, so it is added as
+		// the first paragraph: as plain text, or wrapped.
+		switch p.callout.Label {
+		case LabelKeep:
+			para := ast.NewParagraph()
+			para.AppendChild(para, ast.NewString([]byte(p.label)))
+			alert.AppendChild(alert, para)
+		case LabelWrap:
+			para := ast.NewParagraph()
+			para.AppendChild(para, &CalloutLabel{Label: p.label})
+			alert.AppendChild(alert, para)
+		}
+		for c := p.node.FirstChild(); c != nil; {
+			next := c.NextSibling()
+			alert.AppendChild(alert, c)
+			c = next
+		}
+		parent.ReplaceChild(parent, p.node, alert)
+	}
+	pc.Set(alertsKey, nil)
+}
+
+// Interface guards.
+var _ goldmark.Extender = (*alerts)(nil)
+var _ parser.ParagraphTransformer = (*alertParagraphTransformer)(nil)
+var _ parser.ASTTransformer = (*alertASTTransformer)(nil)
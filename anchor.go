@@ -0,0 +1,113 @@
+package ktw
+
+import (
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// DefaultAnchorSymbol is the text of a heading anchor, unless set otherwise.
+const DefaultAnchorSymbol = "#"
+
+// KindHeadingAnchor is the NodeKind of a HeadingAnchor.
+var KindHeadingAnchor = ast.NewNodeKind("HeadingAnchor")
+
+// HeadingAnchor is an inline node holding a link to the heading it is part
+// of, so that readers can copy a link to a section.
+type HeadingAnchor struct {
+	ast.BaseInline
+	ID     string
+	Symbol string
+}
+
+// Kind implements ast.Node.Kind.
+func (n *HeadingAnchor) Kind() ast.NodeKind {
+	return KindHeadingAnchor
+}
+
+// Dump implements ast.Node.Dump.
+func (n *HeadingAnchor) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"ID": n.ID, "Symbol": n.Symbol}, nil)
+}
+
+// headingAnchors implements heading anchors as a Goldmark extension.
+type headingAnchors struct {
+	symbol string
+	levels map[int]bool // nil for all levels
+}
+
+// NewHeadingAnchors returns a Goldmark extension that appends a link to
+// itself to each heading with an id, at the given levels (or all levels, if
+// none are given), such as:
+//
+//	<h2 id="usage">Usage <a class="anchor" href="#usage">#</a></h2>
+//
+// The text of the link is symbol, or DefaultAnchorSymbol if empty.
+func NewHeadingAnchors(symbol string, levels ...int) goldmark.Extender {
+	e := &headingAnchors{symbol: symbol}
+	if e.symbol == "" {
+		e.symbol = DefaultAnchorSymbol
+	}
+	if len(levels) != 0 {
+		e.levels = make(map[int]bool, len(levels))
+		for _, level := range levels {
+			e.levels[level] = true
+		}
+	}
+	return e
+}
+
+func (e *headingAnchors) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(
+		util.Prioritized(e, 500),
+	))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(e, 500),
+	))
+}
+
+// Transform implements parser.ASTTransformer.
+func (e *headingAnchors) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		heading, ok := node.(*ast.Heading)
+		if !ok || !entering {
+			return ast.WalkContinue, nil
+		}
+		if e.levels != nil && !e.levels[heading.Level] {
+			return ast.WalkSkipChildren, nil
+		}
+		if id, ok := heading.AttributeString("id"); ok {
+			if id, ok := id.([]byte); ok && len(id) != 0 {
+				heading.AppendChild(heading, &HeadingAnchor{ID: string(id), Symbol: e.symbol})
+			}
+		}
+		return ast.WalkSkipChildren, nil
+	})
+}
+
+// RegisterFuncs implements renderer.NodeRenderer.
+func (e *headingAnchors) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindHeadingAnchor, func(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		n := node.(*HeadingAnchor)
+		if n.PreviousSibling() != nil {
+			w.WriteString(" ")
+		}
+		w.WriteString(`<a class="anchor" href="#`)
+		w.Write(util.EscapeHTML(util.URLEscape([]byte(n.ID), false)))
+		w.WriteString(`">`)
+		w.Write(util.EscapeHTML([]byte(n.Symbol)))
+		w.WriteString(`</a>`)
+		return ast.WalkContinue, nil
+	})
+}
+
+// Interface guards.
+var _ goldmark.Extender = (*headingAnchors)(nil)
+var _ parser.ASTTransformer = (*headingAnchors)(nil)
+var _ renderer.NodeRenderer = (*headingAnchors)(nil)
@@ -0,0 +1,69 @@
+package ktw
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestHeadingAnchors(t *testing.T) {
+	ctx := context.Background()
+	doc := md("# Title\n\n## Usage {.note}\n\n### Details {#more aliases=\"old\"}\n")
+	tests := []struct {
+		name    string
+		opts    []EngineOption
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "disabled",
+			want: []string{
+				`<h1 id="title">Title</h1>`,
+				`<h2 class="note" id="usage">Usage</h2>`,
+			},
+			notWant: []string{`class="anchor"`},
+		},
+		{
+			name: "all levels",
+			opts: []EngineOption{WithHeadingAnchors("")},
+			want: []string{
+				`<h1 id="title">Title <a class="anchor" href="#title">#</a></h1>`,
+				`<h2 class="note" id="usage">Usage <a class="anchor" href="#usage">#</a></h2>`,
+				`<h3 id="more"><span id="old"></span>Details <a class="anchor" href="#more">#</a></h3>`,
+			},
+		},
+		{
+			name: "some levels",
+			opts: []EngineOption{WithHeadingAnchors("¶", 2, 3)},
+			want: []string{
+				`<h1 id="title">Title</h1>`,
+				`<h2 class="note" id="usage">Usage <a class="anchor" href="#usage">¶</a></h2>`,
+				`<a class="anchor" href="#more">¶</a></h3>`,
+			},
+		},
+		{
+			name: "escaped symbol",
+			opts: []EngineOption{WithHeadingAnchors("<§>", 1)},
+			want: []string{`<a class="anchor" href="#title">&lt;§&gt;</a></h1>`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := NewMarkdownEngine(tt.opts...).Render(ctx, doc, &buf); err != nil {
+				t.Fatalf("Got error: %+v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("Output does not contain %q:\n%s", want, buf.String())
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(buf.String(), notWant) {
+					t.Errorf("Output contains %q:\n%s", notWant, buf.String())
+				}
+			}
+		})
+	}
+}
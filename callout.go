@@ -0,0 +1,286 @@
+package ktw
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	gmhtml "github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Callout describes the styling of a callout: a paragraph that starts with a
+// prefix followed by a colon, such as "Note:".
+type Callout struct {
+	// Class is added to the class attribute of the resulting HTML element.
+	Class string
+	// Title, if set, is added as the title attribute of the HTML element.
+	Title string
+	// Icon, if set, is added as the data-icon attribute of the HTML element.
+	Icon string
+	// Label selects how the label of the callout (such as "Note:") is
+	// rendered. Defaults to LabelKeep.
+	Label LabelMode
+}
+
+// LabelMode selects how the label of a callout is rendered.
+type LabelMode string
+
+const (
+	// LabelKeep keeps the label as part of the text of the callout. An
+	// alert gets its label, such as "Note", as plain text.
+	LabelKeep LabelMode = ""
+	// LabelWrap wraps the label in a `<strong class="callout-label">`
+	// element, so it can be styled apart from the body.
+	LabelWrap LabelMode = "wrap"
+	// LabelDrop drops the label, such as when the CSS already shows an icon.
+	LabelDrop LabelMode = "drop"
+)
+
+// KindCalloutLabel is the NodeKind of a CalloutLabel.
+var KindCalloutLabel = ast.NewNodeKind("CalloutLabel")
+
+// CalloutLabel is an inline node holding the label of a callout that is
+// rendered with LabelWrap.
+type CalloutLabel struct {
+	ast.BaseInline
+	Label string
+}
+
+// Kind implements ast.Node.Kind.
+func (n *CalloutLabel) Kind() ast.NodeKind {
+	return KindCalloutLabel
+}
+
+// Dump implements ast.Node.Dump.
+func (n *CalloutLabel) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Label": n.Label}, nil)
+}
+
+// callouts implements callouts as a Goldmark extension.
+type callouts struct {
+	callouts map[string]Callout
+}
+
+// NewCallouts returns a Goldmark extension that recognizes paragraphs starting
+// with any of the prefixes in callouts (see NewCalloutBlockParser), and that
+// renders their labels as set by their LabelMode.
+func NewCallouts(c map[string]Callout) goldmark.Extender {
+	return &callouts{callouts: c}
+}
+
+func (e *callouts) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithBlockParsers(
+			util.Prioritized(NewCalloutBlockParser(e.callouts), 1000),
+		),
+		parser.WithASTTransformers(
+			util.Prioritized(&calloutLabelTransformer{}, 200),
+		),
+	)
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(&calloutRenderer{}, 500),
+	))
+}
+
+// DefaultCallouts are the callouts recognised by default, by their prefix
+// (without the colon).
+var DefaultCallouts = map[string]Callout{
+	"Note":    {Class: "note"},
+	"Info":    {Class: "info"},
+	"Warning": {Class: "warning"},
+	"Tip":     {Class: "tip"},
+	"Danger":  {Class: "danger"},
+	"Todo":    {Class: "todo"},
+}
+
+// CalloutBlockParser implements a paragraph block parser that recognizes a
+// paragraph starting with any of a set of prefixes, such as "Note:".
+type CalloutBlockParser struct {
+	parser.BlockParser
+
+	prefixes [][]byte // longest first, including the colon
+	callouts map[string]Callout
+	trigger  []byte
+}
+
+// NewCalloutBlockParser returns a BlockParser that recognizes paragraphs
+// starting with any of the prefixes (followed by a colon) in callouts. It
+// then ensures that the resulting HTML element has the callout's class added
+// to aid in styling. Labels rendered with LabelWrap are only added when the
+// parser is installed with NewCallouts.
+func NewCalloutBlockParser(callouts map[string]Callout) parser.BlockParser {
+	b := &CalloutBlockParser{
+		BlockParser: parser.NewParagraphParser(),
+		callouts:    make(map[string]Callout, len(callouts)),
+	}
+	seen := make(map[byte]bool)
+	for prefix, callout := range callouts {
+		if prefix == "" {
+			continue
+		}
+		b.callouts[prefix+":"] = callout
+		b.prefixes = append(b.prefixes, []byte(prefix+":"))
+		if !seen[prefix[0]] {
+			seen[prefix[0]] = true
+			b.trigger = append(b.trigger, prefix[0])
+		}
+	}
+	// Match the longest prefix first, so that the result does not depend on
+	// the order of the map.
+	sort.Slice(b.prefixes, func(i, j int) bool {
+		if len(b.prefixes[i]) != len(b.prefixes[j]) {
+			return len(b.prefixes[i]) > len(b.prefixes[j])
+		}
+		return bytes.Compare(b.prefixes[i], b.prefixes[j]) < 0
+	})
+	return b
+}
+
+// NewNoteBlockParser returns a CalloutBlockParser that only recognizes the
+// "Note:" callout.
+func NewNoteBlockParser() parser.BlockParser {
+	return NewCalloutBlockParser(map[string]Callout{"Note": DefaultCallouts["Note"]})
+}
+
+// NewInfoBlockParser returns a CalloutBlockParser that only recognizes the
+// "Info:" callout.
+func NewInfoBlockParser() parser.BlockParser {
+	return NewCalloutBlockParser(map[string]Callout{"Info": DefaultCallouts["Info"]})
+}
+
+// NewWarningBlockParser returns a CalloutBlockParser that only recognizes the
+// "Warning:" callout.
+func NewWarningBlockParser() parser.BlockParser {
+	return NewCalloutBlockParser(map[string]Callout{"Warning": DefaultCallouts["Warning"]})
+}
+
+// Close closes the paragraph, and removes what remains of the first line if
+// it only held the (removed) label.
+func (b *CalloutBlockParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {
+	b.BlockParser.Close(node, reader, pc)
+	if node.Parent() == nil {
+		return
+	}
+	if lines := node.Lines(); lines.Len() != 0 && lines.At(0).Start == lines.At(0).Stop {
+		lines.SetSliced(1, lines.Len())
+	}
+}
+
+// Trigger will be triggered for lines starting with the first character of
+// any of the prefixes.
+func (b *CalloutBlockParser) Trigger() []byte {
+	return b.trigger
+}
+
+func (b *CalloutBlockParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	buf, _ := reader.PeekLine()
+	var callout Callout
+	var prefix []byte
+	for _, p := range b.prefixes {
+		if bytes.HasPrefix(buf, p) {
+			callout, prefix = b.callouts[string(p)], p
+			break
+		}
+	}
+	found := prefix != nil
+	pos := pc.BlockOffset()
+	if pos < 0 || !found {
+		return nil, parser.NoChildren
+	}
+	p, state := b.BlockParser.Open(parent, reader, pc)
+	if p != nil && callout.Label != LabelKeep {
+		// Remove the label from the paragraph, the leading spaces that
+		// remain are trimmed when the paragraph is closed.
+		first := p.Lines().At(0)
+		label := first.Value(reader.Source())[:len(prefix)]
+		p.Lines().Set(0, first.WithStart(first.Start+len(prefix)))
+		if callout.Label == LabelWrap {
+			pending, _ := pc.Get(calloutLabelsKey).([]pendingLabel)
+			pc.Set(calloutLabelsKey, append(pending, pendingLabel{node: p, label: string(label)}))
+		}
+	}
+	if p != nil {
+		// Set the "class" (and other) attributes for the paragraph
+		p.SetAttributeString("class", callout.Class)
+		if callout.Title != "" {
+			p.SetAttributeString("title", callout.Title)
+		}
+		if callout.Icon != "" {
+			p.SetAttributeString("data-icon", callout.Icon)
+		}
+	}
+	return p, state
+}
+
+var calloutLabelsKey = parser.NewContextKey()
+
+// pendingLabel is the label of a callout paragraph, to be added to it once
+// the document has been parsed.
+type pendingLabel struct {
+	node  ast.Node
+	label string
+}
+
+// calloutLabelTransformer adds the labels of callouts rendered with
+// LabelWrap as the first child of their paragraphs.
+type calloutLabelTransformer struct{}
+
+func (t *calloutLabelTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	pending, _ := pc.Get(calloutLabelsKey).([]pendingLabel)
+	for _, p := range pending {
+		if p.node.Parent() == nil {
+			continue // the paragraph has been removed or transformed
+		}
+		label := &CalloutLabel{Label: p.label}
+		if first := p.node.FirstChild(); first != nil {
+			p.node.InsertBefore(p.node, first, label)
+		} else {
+			p.node.AppendChild(p.node, label)
+		}
+	}
+	pc.Set(calloutLabelsKey, nil)
+}
+
+// calloutRenderer renders the nodes of callouts and alerts.
+type calloutRenderer struct{}
+
+func (r *calloutRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindAlert, r.renderAlert)
+	reg.Register(KindCalloutLabel, r.renderCalloutLabel)
+}
+
+// renderAlert renders an Alert as a "<div>".
+func (r *calloutRenderer) renderAlert(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		w.WriteString("<div")
+		gmhtml.RenderAttributes(w, node, gmhtml.GlobalAttributeFilter)
+		w.WriteString(">\n")
+	} else {
+		w.WriteString("</div>\n")
+	}
+	return ast.WalkContinue, nil
+}
+
+func (r *calloutRenderer) renderCalloutLabel(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*CalloutLabel)
+	w.WriteString(`<strong class="callout-label">`)
+	w.Write(util.EscapeHTML([]byte(n.Label)))
+	w.WriteString(`</strong>`)
+	if n.NextSibling() != nil {
+		w.WriteString(" ")
+	}
+	return ast.WalkSkipChildren, nil
+}
+
+// Interface guards.
+var _ goldmark.Extender = (*callouts)(nil)
+var _ parser.ASTTransformer = (*calloutLabelTransformer)(nil)
+var _ renderer.NodeRenderer = (*calloutRenderer)(nil)
@@ -0,0 +1,171 @@
+package ktw
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestCallouts(t *testing.T) {
+	ctx := context.Background()
+	engine := NewMarkdownEngine(WithCallouts(map[string]Callout{
+		"Note":          {Class: "note"},
+		"Security":      {Class: "security", Title: "Security advice", Icon: "lock"},
+		"Security Note": {Class: "security-note"},
+	}))
+	tests := []struct {
+		name string
+		doc  string
+		want string
+	}{
+		{
+			name: "preset",
+			doc:  "Note: a note.",
+			want: "<p class=\"note\">Note: a note.</p>\n",
+		},
+		{
+			name: "title and icon",
+			doc:  "Security: be careful.",
+			want: "<p class=\"security\" title=\"Security advice\" data-icon=\"lock\">Security: be careful.</p>\n",
+		},
+		{
+			name: "longest prefix",
+			doc:  "Security Note: also careful.",
+			want: "<p class=\"security-note\">Security Note: also careful.</p>\n",
+		},
+		{
+			name: "unknown prefix",
+			doc:  "Tip: not configured.",
+			want: "<p>Tip: not configured.</p>\n",
+		},
+		{
+			name: "not at start",
+			doc:  "A paragraph with\nNote: in the middle.",
+			want: "<p>A paragraph with\nNote: in the middle.</p>\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := engine.Render(ctx, Markdown(tt.doc), &buf); err != nil {
+				t.Fatalf("Got error: %+v", err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("Got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAlerts(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		doc  string
+		want string
+	}{
+		{
+			name: "note",
+			doc:  "> [!NOTE]\n> A note.",
+			want: "<div class=\"note\">\n<p>Note</p>\n<p>A note.</p>\n</div>\n",
+		},
+		{
+			name: "github type",
+			doc:  "> [!caution]\n> Careful.",
+			want: "<div class=\"danger\">\n<p>Caution</p>\n<p>Careful.</p>\n</div>\n",
+		},
+		{
+			name: "multiple blocks",
+			doc:  "> [!WARNING]\n>\n> First.\n>\n> - one\n> - two\n>\n> '''\n> code\n> '''",
+			want: "<div class=\"warning\">\n<p>Warning</p>\n<p>First.</p>\n<ul>\n<li>one</li>\n<li>two</li>\n</ul>\n" +
+				"<pre class=\"chroma\"><code class=\"language-unknown\">code\n</code></pre></div>\n",
+		},
+		{
+			name: "nested",
+			doc:  "- item\n\n  > [!TIP]\n  > Nested.",
+			want: "<ul>\n<li>\n<p>item</p>\n<div class=\"tip\">\n<p>Tip</p>\n<p>Nested.</p>\n</div>\n</li>\n</ul>\n",
+		},
+		{
+			name: "unknown type",
+			doc:  "> [!UNKNOWN]\n> Quote.",
+			want: "<blockquote>\n<p>[!UNKNOWN]\nQuote.</p>\n</blockquote>\n",
+		},
+		{
+			name: "not first line",
+			doc:  "> Quote.\n> [!NOTE]",
+			want: "<blockquote>\n<p>Quote.\n[!NOTE]</p>\n</blockquote>\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := DefaultMarkdownEngine().Render(ctx, md(tt.doc), &buf); err != nil {
+				t.Fatalf("Got error: %+v", err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("Got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalloutLabels(t *testing.T) {
+	ctx := context.Background()
+	engine := NewMarkdownEngine(WithCallouts(map[string]Callout{
+		"Note":    {Class: "note", Label: LabelWrap},
+		"Tip":     {Class: "tip", Label: LabelDrop},
+		"Warning": {Class: "warning"},
+	}))
+	tests := []struct {
+		name string
+		doc  string
+		want string
+	}{
+		{
+			name: "wrap",
+			doc:  "Note: *a* note.",
+			want: "<p class=\"note\"><strong class=\"callout-label\">Note:</strong> <em>a</em> note.</p>\n",
+		},
+		{
+			name: "wrap only label",
+			doc:  "Note:\nOn the next line.",
+			want: "<p class=\"note\"><strong class=\"callout-label\">Note:</strong> On the next line.</p>\n",
+		},
+		{
+			name: "drop",
+			doc:  "Tip: a tip.",
+			want: "<p class=\"tip\">a tip.</p>\n",
+		},
+		{
+			name: "keep",
+			doc:  "Warning: a warning.",
+			want: "<p class=\"warning\">Warning: a warning.</p>\n",
+		},
+		{
+			name: "alert wrap",
+			doc:  "> [!NOTE]\n> A note.",
+			want: "<div class=\"note\">\n<p><strong class=\"callout-label\">Note</strong></p>\n<p>A note.</p>\n</div>\n",
+		},
+		{
+			name: "alert drop",
+			doc:  "> [!TIP]\n> A tip.",
+			want: "<div class=\"tip\">\n<p>A tip.</p>\n</div>\n",
+		},
+		{
+			name: "alert keep",
+			doc:  "> [!WARNING]\n> A warning.",
+			want: "<div class=\"warning\">\n<p>Warning</p>\n<p>A warning.</p>\n</div>\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := engine.Render(ctx, Markdown(tt.doc), &buf); err != nil {
+				t.Fatalf("Got error: %+v", err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("Got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
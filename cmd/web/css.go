@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/nuttyswiss/ktw"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	var cmd = &cobra.Command{
+		Use:   "css",
+		Short: "Write the stylesheet for highlighted code",
+		RunE:  css,
+	}
+	cmd.Flags().StringP("output", "o", "", "file to write the stylesheet to (default stdout)")
+	cmd.Flags().String("light", "", "Chroma style to use (overrides css.light)")
+	cmd.Flags().String("dark", "", "Chroma style to use for a dark color scheme (overrides css.dark)")
+	cli.AddCommand(cmd)
+}
+
+// css writes the stylesheet for the classes used by highlighted code blocks.
+// The Chroma styles are taken from the 'css' section of the config file, or
+// the flags. If a dark style is given, it is used when the reader prefers a
+// dark color scheme.
+func css(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("css takes no arguments")
+	}
+	light := viper.GetString("css.light")
+	if flag := cmd.Flag("light").Value.String(); flag != "" {
+		light = flag
+	}
+	if light == "" {
+		light = "github"
+	}
+	dark := viper.GetString("css.dark")
+	if flag := cmd.Flag("dark").Value.String(); flag != "" {
+		dark = flag
+	}
+
+	var stylesheet string
+	var err error
+	if dark == "" {
+		stylesheet, err = ktw.ChromaCSS(light)
+	} else {
+		stylesheet, err = ktw.ChromaColorSchemeCSS(light, dark)
+	}
+	if err != nil {
+		return err
+	}
+
+	output := cmd.Flag("output").Value.String()
+	if output == "" {
+		fmt.Print(stylesheet)
+		return nil
+	}
+	if err := os.WriteFile(output, []byte(stylesheet), 0644); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s\n", output)
+	return nil
+}
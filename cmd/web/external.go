@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Defaults of the external link checker, as set by the 'links' section of
+// the config file.
+const (
+	defaultLinksCache       = ".web/links.json"
+	defaultLinksConcurrency = 4
+	defaultLinksInterval    = time.Second
+	defaultLinksTimeout     = 10 * time.Second
+	defaultLinksCacheTTL    = 24 * time.Hour
+)
+
+// linkResult is the result of checking an external link, as kept in the
+// cache file.
+type linkResult struct {
+	Status  int       `json:"status,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	Checked time.Time `json:"checked"`
+}
+
+// ok reports whether the link works.
+func (r linkResult) ok() bool {
+	return r.Error == "" && r.Status < 400
+}
+
+// reason returns why the link is broken.
+func (r linkResult) reason() string {
+	if r.Error != "" {
+		return r.Error
+	}
+	return fmt.Sprintf("%d %s", r.Status, http.StatusText(r.Status))
+}
+
+// externalChecker checks external links with HEAD requests, falling back to
+// GET requests for servers that do not handle HEAD. At most concurrency
+// requests are made at once, and at most one every interval to each host.
+// Working links are cached in a file for ttl, so repeated runs are cheap.
+type externalChecker struct {
+	client      *http.Client
+	concurrency int
+	interval    time.Duration
+	ttl         time.Duration
+	cachePath   string // no cache if empty
+
+	mu    sync.Mutex
+	cache map[string]linkResult
+	hosts map[string]*hostLimiter
+}
+
+// hostLimiter spaces the requests made to a host.
+type hostLimiter struct {
+	mu   sync.Mutex
+	next time.Time
+}
+
+// wait blocks until a request can be made, interval after the previous one.
+func (l *hostLimiter) wait(ctx context.Context, interval time.Duration) error {
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(interval)
+	l.mu.Unlock()
+
+	t := time.NewTimer(at.Sub(now))
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// newExternalChecker returns an externalChecker configured by the optional
+// 'links' section of the config file.
+func newExternalChecker() *externalChecker {
+	c := &externalChecker{
+		client:      &http.Client{Timeout: defaultLinksTimeout},
+		concurrency: defaultLinksConcurrency,
+		interval:    defaultLinksInterval,
+		ttl:         defaultLinksCacheTTL,
+		cachePath:   defaultLinksCache,
+	}
+	if viper.IsSet("links.concurrency") && viper.GetInt("links.concurrency") > 0 {
+		c.concurrency = viper.GetInt("links.concurrency")
+	}
+	if viper.IsSet("links.interval") {
+		c.interval = viper.GetDuration("links.interval")
+	}
+	if viper.IsSet("links.timeout") {
+		c.client.Timeout = viper.GetDuration("links.timeout")
+	}
+	if viper.IsSet("links.cachettl") {
+		c.ttl = viper.GetDuration("links.cachettl")
+	}
+	if viper.IsSet("links.cache") {
+		c.cachePath = viper.GetString("links.cache")
+	}
+	return c
+}
+
+// loadCache reads the cache file, if any.
+func (c *externalChecker) loadCache() error {
+	c.cache = make(map[string]linkResult)
+	if c.cachePath == "" {
+		return nil
+	}
+	buf, err := os.ReadFile(c.cachePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(buf, &c.cache); err != nil {
+		return fmt.Errorf("failed to parse %q: %w", c.cachePath, err)
+	}
+	return nil
+}
+
+// saveCache writes the working links to the cache file.
+func (c *externalChecker) saveCache() error {
+	if c.cachePath == "" {
+		return nil
+	}
+	working := make(map[string]linkResult)
+	for link, result := range c.cache {
+		if result.ok() {
+			working[link] = result
+		}
+	}
+	buf, err := json.MarshalIndent(working, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.cachePath), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(c.cachePath, append(buf, '\n'), 0644)
+}
+
+// check checks the external links, each along with the pages (relative to
+// the site's root) it was found in, and returns those that are broken.
+func (c *externalChecker) check(ctx context.Context, links map[string][]string) ([]brokenLink, error) {
+	if err := c.loadCache(); err != nil {
+		return nil, err
+	}
+	c.hosts = make(map[string]*hostLimiter)
+
+	// Links are checked without their fragment, so each page is only
+	// requested once.
+	pages := make(map[string][]string)
+	for link, in := range links {
+		u, err := url.Parse(link)
+		if err != nil {
+			continue
+		}
+		u.Fragment = ""
+		pages[u.String()] = append(pages[u.String()], in...)
+	}
+	var todo []string
+	for link, in := range pages {
+		sort.Strings(in)
+		pages[link] = slices.Compact(in)
+		if result, ok := c.cache[link]; ok && result.ok() && time.Since(result.Checked) < c.ttl {
+			continue
+		}
+		todo = append(todo, link)
+	}
+	sort.Strings(todo)
+
+	queue := make(chan string)
+	var wg sync.WaitGroup
+	for range min(c.concurrency, len(todo)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for link := range queue {
+				result := c.fetch(ctx, link)
+				c.mu.Lock()
+				c.cache[link] = result
+				c.mu.Unlock()
+			}
+		}()
+	}
+	for _, link := range todo {
+		queue <- link
+	}
+	close(queue)
+	wg.Wait()
+
+	if err := c.saveCache(); err != nil {
+		return nil, err
+	}
+
+	var broken []brokenLink
+	for _, link := range todo {
+		result := c.cache[link]
+		if result.ok() {
+			continue
+		}
+		for _, page := range pages[link] {
+			broken = append(broken, brokenLink{page: page, link: link, reason: result.reason()})
+		}
+	}
+	sort.Slice(broken, func(i, j int) bool {
+		if broken[i].page != broken[j].page {
+			return broken[i].page < broken[j].page
+		}
+		return broken[i].link < broken[j].link
+	})
+	return broken, nil
+}
+
+// fetch checks a single link, with a HEAD request, and a GET request if the
+// HEAD request fails.
+func (c *externalChecker) fetch(ctx context.Context, link string) linkResult {
+	status, err := c.request(ctx, http.MethodHead, link)
+	if err != nil || status >= 400 {
+		status, err = c.request(ctx, http.MethodGet, link)
+	}
+	result := linkResult{Status: status, Checked: time.Now()}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// request makes a request to link, once its host's rate limit allows, and
+// returns the status code of the response.
+func (c *externalChecker) request(ctx context.Context, method, link string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, link, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", "web-linkcheck/1.0")
+
+	c.mu.Lock()
+	limiter, ok := c.hosts[req.URL.Host]
+	if !ok {
+		limiter = &hostLimiter{}
+		c.hosts[req.URL.Host] = limiter
+	}
+	c.mu.Unlock()
+	if err := limiter.wait(ctx, c.interval); err != nil {
+		return 0, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Drain some of the body, so the connection can be reused.
+	io.CopyN(io.Discard, resp.Body, 64<<10)
+	return resp.StatusCode, nil
+}
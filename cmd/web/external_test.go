@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testServer serves the paths used by the external link tests, and counts
+// the requests it receives.
+type testServer struct {
+	*httptest.Server
+	requests atomic.Int32
+
+	mu              sync.Mutex
+	inflight, maxIn int
+	delay           time.Duration
+	requestTimes    []time.Time
+}
+
+func newTestServer(t *testing.T, delay time.Duration) *testServer {
+	s := &testServer{delay: delay}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		s.mu.Lock()
+		s.inflight++
+		s.maxIn = max(s.maxIn, s.inflight)
+		s.requestTimes = append(s.requestTimes, time.Now())
+		s.mu.Unlock()
+		defer func() {
+			s.mu.Lock()
+			s.inflight--
+			s.mu.Unlock()
+		}()
+		time.Sleep(s.delay)
+
+		switch r.URL.Path {
+		case "/ok", "/ok2", "/ok3", "/ok4":
+		case "/no-head":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		case "/error":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func testExternalChecker(t *testing.T) *externalChecker {
+	return &externalChecker{
+		client:      &http.Client{Timeout: 5 * time.Second},
+		concurrency: 2,
+		ttl:         time.Hour,
+		cachePath:   filepath.Join(t.TempDir(), ".web", "links.json"),
+	}
+}
+
+func TestExternalChecker(t *testing.T) {
+	ctx := context.Background()
+	srv := newTestServer(t, 0)
+	links := map[string][]string{
+		srv.URL + "/ok":         {"index.html"},
+		srv.URL + "/ok#section": {"index.html", "blog/a.html"},
+		srv.URL + "/no-head":    {"blog/a.html"},
+		srv.URL + "/missing":    {"index.html", "blog/a.html"},
+		srv.URL + "/error":      {"index.html"},
+	}
+	c := testExternalChecker(t)
+	got, err := c.check(ctx, links)
+	if err != nil {
+		t.Fatalf("Got error: %+v", err)
+	}
+	want := []brokenLink{
+		{"blog/a.html", srv.URL + "/missing", "404 Not Found"},
+		{"index.html", srv.URL + "/error", "500 Internal Server Error"},
+		{"index.html", srv.URL + "/missing", "404 Not Found"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got broken links:\n%v\nwant:\n%v", got, want)
+	}
+	// HEAD for each link, and GET for those that failed.
+	if n := srv.requests.Load(); n != 7 {
+		t.Errorf("Got %d requests, want 7", n)
+	}
+
+	// The working links are cached, the broken ones are checked again.
+	srv.requests.Store(0)
+	got, err = c.check(ctx, links)
+	if err != nil {
+		t.Fatalf("Got error: %+v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got broken links:\n%v\nwant:\n%v", got, want)
+	}
+	if n := srv.requests.Load(); n != 4 {
+		t.Errorf("Got %d requests with a cache, want 4", n)
+	}
+
+	// Expired entries are checked again.
+	srv.requests.Store(0)
+	c.ttl = 0
+	if _, err := c.check(ctx, links); err != nil {
+		t.Fatalf("Got error: %+v", err)
+	}
+	if n := srv.requests.Load(); n != 7 {
+		t.Errorf("Got %d requests with an expired cache, want 7", n)
+	}
+}
+
+func TestExternalCheckerLimits(t *testing.T) {
+	ctx := context.Background()
+	srv := newTestServer(t, 20*time.Millisecond)
+	links := map[string][]string{
+		srv.URL + "/ok":  {"index.html"},
+		srv.URL + "/ok2": {"index.html"},
+		srv.URL + "/ok3": {"index.html"},
+		srv.URL + "/ok4": {"index.html"},
+	}
+
+	c := testExternalChecker(t)
+	if _, err := c.check(ctx, links); err != nil {
+		t.Fatalf("Got error: %+v", err)
+	}
+	if srv.maxIn > c.concurrency {
+		t.Errorf("Got %d concurrent requests, want at most %d", srv.maxIn, c.concurrency)
+	}
+
+	srv.requestTimes = nil
+	c = testExternalChecker(t)
+	c.interval = 50 * time.Millisecond
+	if _, err := c.check(ctx, links); err != nil {
+		t.Fatalf("Got error: %+v", err)
+	}
+	for i := 1; i < len(srv.requestTimes); i++ {
+		// Allow for some timer slack.
+		if d := srv.requestTimes[i].Sub(srv.requestTimes[i-1]); d < 45*time.Millisecond {
+			t.Errorf("Got requests %v apart, want at least %v", d, c.interval)
+		}
+	}
+}
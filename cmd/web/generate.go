@@ -3,16 +3,18 @@ package main
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"io/fs"
+	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
-	"text/template"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
 
-	"github.com/nuttyswiss/ktw"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
-	"gopkg.in/yaml.v3"
 )
 
 func init() {
@@ -21,128 +23,296 @@ func init() {
 		Short: "Generate the website",
 		RunE:  generate,
 	}
+	cmd.Flags().Bool("force", false, "generate every file, even if its inputs are unchanged")
+	cmd.Flags().IntP("jobs", "j", runtime.GOMAXPROCS(0), "number of files to generate in parallel")
+	cmd.Flags().BoolP("watch", "w", false, "keep running, and generate the site again as it changes")
 	cli.AddCommand(cmd)
 }
 
-// splitContent split the full contents of a file into the frontmatter
-// delimiter, the metadata, and the rest of the content. It returns an
-// error if delimiter is not found.
-func splitContent(buf []byte) ([]byte, []byte, []byte, error) {
-	delim, rest, present := bytes.Cut(buf, []byte("\n"))
-	if !present {
-		return nil, nil, nil, fmt.Errorf("delimiter not found")
+// generate traverses a directory of files representing a web site. For each
+// file that we encounter, if it is a file that we need to process, we go and
+// process that file (usually generate an HTML file from Markdown). When the
+// site is generated into a separate 'output' directory, the other files are
+// copied into it. Files whose inputs are unchanged since the last run, as
+// recorded in the build manifest, are skipped unless --force is given. Up to
+// --jobs files are handled in parallel. With --watch, generate keeps running
+// and generates the site again whenever it changes.
+func generate(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("generate takes no arguments")
 	}
-	delim = append(delim, '\n')
-
-	meta, content, ok := bytes.Cut(rest, delim)
-	if !ok {
-		return nil, nil, nil, fmt.Errorf("delimiter not found")
+	force, _ := cmd.Flags().GetBool("force")
+	jobs, _ := cmd.Flags().GetInt("jobs")
+	if jobs < 1 {
+		return fmt.Errorf("--jobs must be at least 1")
+	}
+	watch, _ := cmd.Flags().GetBool("watch")
+	s, err := newSite()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Generating from %s\n", s.root)
+	start := time.Now()
+	stats, err := s.build(force, jobs)
+	if err != nil && !watch {
+		return err
 	}
+	if !watch {
+		fmt.Println(stats)
+		return nil
+	}
+	printSummary(start, stats, err)
+	return watchSite(s, jobs)
+}
 
-	return delim, meta, content, nil
+// watchSite watches the site s for changes, until interrupted. On every
+// change to its Markdown, templates, defaults, config or other files, the
+// config is read again and the site is generated again, printing a summary
+// of the build. Failed builds are reported, and the site is still watched.
+func watchSite(s *site, jobs int) error {
+	w, err := newWatcher(func(path string, dir bool) bool {
+		return s.triggers(path, dir)
+	}, s.watchDirs()...)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	fmt.Println("Watching for changes, press Ctrl-C to stop")
+	return w.run(ctx, func(paths []string) {
+		start := time.Now()
+		var stats buildStats
+		next, err := reloadSite()
+		if err == nil {
+			s = next
+			stats, err = s.build(false, jobs)
+		}
+		printSummary(start, stats, err)
+	})
 }
 
-func parseTemplates(paths []string) (*template.Template, error) {
-	tmpl, err := template.New("").Delims("<<", ">>").ParseFiles(paths...)
+// printSummary prints a one-line summary of a build started at start.
+func printSummary(start time.Time, stats buildStats, err error) {
+	prefix := fmt.Sprintf("[%s]", start.Format(time.TimeOnly))
 	if err != nil {
-		return nil, err
+		msg := strings.ReplaceAll(err.Error(), "\n", "; ")
+		fmt.Printf("%s Build failed: %s\n", prefix, msg)
+		return
 	}
-	return tmpl, nil
+	fmt.Printf("%s %s in %v\n", prefix, stats, time.Since(start).Round(time.Millisecond))
 }
 
-// generate traverses a directory of files representing a web site. For each
-// file that we encounter, if it is a file that we need to process, we go and
-// process that file (usually generate an HTML file from Markdown).
-func generate(cmd *cobra.Command, args []string) error {
-	if len(args) != 0 {
-		return fmt.Errorf("generate takes no arguments")
+// buildStats counts the files handled by a build.
+type buildStats struct {
+	generated, copied, unchanged int
+}
+
+func (b buildStats) String() string {
+	return fmt.Sprintf("Generated %d page(s), copied %d file(s), %d unchanged", b.generated, b.copied, b.unchanged)
+}
+
+// buildResult is the outcome of generating, or copying, a single file that
+// did not fail.
+type buildResult struct {
+	unchanged bool
+	warnings  []string
+}
+
+// build generates the pages of the site, and copies its other files, into
+// the output directory, handling up to jobs files in parallel. Unless force
+// is set, only the files whose inputs have changed since the last build are
+// handled. A file that fails does not stop the others: the errors of all the
+// failed files are returned together, and the files are logged in order,
+// whatever order they were handled in.
+func (s *site) build(force bool, jobs int) (buildStats, error) {
+	var stats buildStats
+	pages, assets, err := s.files()
+	if err != nil {
+		return stats, err
 	}
-	root := viper.GetString("dir")
-	if root == "" {
-		return fmt.Errorf("config is missing 'dir' key")
+	m, err := loadManifest(manifestFile)
+	if err != nil {
+		return stats, err
 	}
+	// The new manifest only holds the files of this build.
+	built := &manifest{path: m.path, Outputs: make(map[string]manifestEntry)}
 
-	var templates *template.Template
-	tmplPaths := viper.GetStringSlice("templates")
-	if len(tmplPaths) != 0 {
-		tmpl, err := parseTemplates(tmplPaths)
+	// Read all the sources first, so every page can list the whole site. The
+	// sources that fail to parse are left out of the site, and the others are
+	// still generated.
+	read := make([]*source, len(pages))
+	errs := parallel(jobs, len(pages), func(i int) (err error) {
+		read[i], err = s.readSource(pages[i])
+		return err
+	})
+	var srcs []*source
+	var failed []error
+	for i, err := range errs {
 		if err != nil {
-			return err
+			failed = append(failed, err)
+			continue
 		}
-		templates = tmpl
+		srcs = append(srcs, read[i])
 	}
+	site := siteTOC(srcs)
+	hashes := hashSite(site)
 
-	fmt.Printf("Generating from %s\n", root)
-	err := filepath.WalkDir(root, func(src string, d fs.DirEntry, err error) error {
+	entries := make([]manifestEntry, len(srcs))
+	results := make([]buildResult, len(srcs))
+	errs = parallel(jobs, len(srcs), func(i int) (err error) {
+		doc := srcs[i]
+		dstpath := htmlPath(doc.path)
+		dst := filepath.Join(s.output, dstpath)
+		entries[i], err = hashInputs(doc.inputs)
 		if err != nil {
 			return err
 		}
-		if d.IsDir() {
+		entries[i].Site = hashes[doc.siteUse]
+		if !force && upToDate(m, dst, dstpath, entries[i]) {
+			results[i].unchanged = true
 			return nil
 		}
 
-		srcpath, err := filepath.Rel(root, src)
-		if err != nil {
-			return err
+		page := doc.page()
+		page.Site = site
+		var outbuf bytes.Buffer
+		if err := page.Render(doc.context(context.Background()), &outbuf); err != nil {
+			return fmt.Errorf("failed to render %q: %w", doc.path, err)
 		}
-		name := filepath.Base(srcpath)
-		ext := filepath.Ext(name)
-		if ext != ".md" {
-			return nil
+		results[i].warnings = page.Warnings
+		return writeFile(dst, outbuf.Bytes())
+	})
+	for i, doc := range srcs {
+		dstpath := htmlPath(doc.path)
+		res := results[i]
+		switch {
+		case errs[i] != nil:
+			failed = append(failed, errs[i])
+			continue
+		case res.unchanged:
+			stats.unchanged++
+		default:
+			fmt.Printf("Generate HTML: %s --> %s, Done!\n", doc.path, dstpath)
+			for _, warning := range res.warnings {
+				fmt.Printf("Warning: %s: %s\n", doc.path, warning)
+			}
+			stats.generated++
 		}
+		built.Outputs[dstpath] = entries[i]
+	}
 
-		dstpath := srcpath[:len(srcpath)-len(ext)] + ".html"
-		dst := filepath.Join(root, dstpath)
-		fmt.Printf("Generate HTML: %s --> %s", srcpath, dstpath)
-
-		inbuf, err := os.ReadFile(src)
+	entries = make([]manifestEntry, len(assets))
+	results = make([]buildResult, len(assets))
+	errs = parallel(jobs, len(assets), func(i int) (err error) {
+		src := filepath.Join(s.root, assets[i])
+		dst := filepath.Join(s.output, assets[i])
+		entries[i], err = hashInputs([]string{src})
 		if err != nil {
 			return err
 		}
-
-		delim, frontmatter, content, err := splitContent(inbuf)
-		if err != nil {
-			return fmt.Errorf("failed to split content in %q: %w", srcpath, err)
-		}
-		metadata := make(map[string]string)
-		if bytes.HasPrefix(delim, []byte("---")) {
-			if err := yaml.Unmarshal(frontmatter, metadata); err != nil {
-				return fmt.Errorf("failed to parse metadata in %q: %w", srcpath, err)
-			}
-		}
-		title := name
-		if tt, ok := metadata["title"]; ok {
-			title = tt
+		if !force && upToDate(m, dst, assets[i], entries[i]) {
+			results[i].unchanged = true
+			return nil
 		}
-		var tmpl *template.Template
-		if tmplName, ok := metadata["style"]; ok {
-			tmpl = templates.Lookup(tmplName + ".tmpl")
-			if tmpl == nil {
-				return fmt.Errorf("template %q not found", tmplName+".tmpl")
-			}
+		return copyFile(dst, src)
+	})
+	for i, srcpath := range assets {
+		res := results[i]
+		switch {
+		case errs[i] != nil:
+			failed = append(failed, errs[i])
+			continue
+		case res.unchanged:
+			stats.unchanged++
+		default:
+			fmt.Printf("Copy: %s\n", srcpath)
+			stats.copied++
 		}
+		built.Outputs[srcpath] = entries[i]
+	}
 
-		page := ktw.Page{
-			Title:    title,
-			Metadata: metadata,
-			Contents: []ktw.Renderer{ktw.Markdown(content)},
-			Template: tmpl,
+	// Failed files are left out of the manifest, so they are handled again
+	// by the next build. The files generated from sources that are gone are
+	// kept in it for as long as they exist, for verify to report them.
+	current := make(map[string]bool, len(pages)+len(assets))
+	for _, srcpath := range pages {
+		current[htmlPath(srcpath)] = true
+	}
+	for _, srcpath := range assets {
+		current[srcpath] = true
+	}
+	for dstpath, entry := range m.Outputs {
+		if current[dstpath] {
+			continue
 		}
-		var outbuf bytes.Buffer
-		if err := page.Render(context.Background(), &outbuf); err != nil {
-			return err
+		if _, err := os.Stat(filepath.Join(s.output, dstpath)); err == nil {
+			built.Outputs[dstpath] = entry
 		}
-		fmt.Println(", Done!")
+	}
+	if err := built.save(); err != nil {
+		failed = append(failed, err)
+	}
+	return stats, errors.Join(failed...)
+}
 
-		if err := os.WriteFile(dst, outbuf.Bytes(), 0644); err != nil {
-			return err
-		}
+// parallel calls fn for each index in [0, n), from up to jobs goroutines,
+// and returns the error returned for each index.
+func parallel(jobs, n int, fn func(i int) error) []error {
+	errs := make([]error, n)
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range min(jobs, n) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				errs[i] = fn(i)
+			}
+		}()
+	}
+	for i := range n {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return errs
+}
 
-		return nil
-	})
-	if err != nil {
+// upToDate reports whether the file at dst exists and, as recorded in m, was
+// generated at dstpath from the inputs of entry.
+func upToDate(m *manifest, dst, dstpath string, entry manifestEntry) bool {
+	if _, err := os.Stat(dst); err != nil {
+		return false
+	}
+	reason, _ := m.changed(dstpath, entry)
+	return reason == ""
+}
+
+// writeFile writes buf to the file at path, creating its directory if needed.
+func writeFile(path string, buf []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
 		return err
 	}
+	return os.WriteFile(path, buf, 0644)
+}
 
-	return nil
+// copyFile copies the file at src to dst, creating its directory if needed.
+func copyFile(dst, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
 }
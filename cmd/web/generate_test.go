@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestParallel(t *testing.T) {
+	var mu sync.Mutex
+	inflight, maxIn := 0, 0
+	seen := make([]bool, 10)
+	errs := parallel(3, len(seen), func(i int) error {
+		mu.Lock()
+		inflight++
+		maxIn = max(maxIn, inflight)
+		seen[i] = true
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		inflight--
+		mu.Unlock()
+		if i%4 == 0 {
+			return fmt.Errorf("failed %d", i)
+		}
+		return nil
+	})
+
+	if maxIn > 3 {
+		t.Errorf("Got %d concurrent calls, want at most 3", maxIn)
+	}
+	for i, ok := range seen {
+		if !ok {
+			t.Errorf("Index %d was not handled", i)
+		}
+	}
+	for i, err := range errs {
+		if want := i%4 == 0; (err != nil) != want {
+			t.Errorf("Got error %v for index %d", err, i)
+		} else if want && err.Error() != fmt.Sprintf("failed %d", i) {
+			t.Errorf("Got error %q for index %d", err, i)
+		}
+	}
+
+	if errs := parallel(4, 0, nil); len(errs) != 0 {
+		t.Errorf("Got %d errors for no calls", len(errs))
+	}
+}
+
+func TestBuildFailures(t *testing.T) {
+	s := testSite(t, map[string]string{
+		"htdocs/index.md": "# Home\n\n{{sitetoc}}\n",
+		"htdocs/bad.md":   "[Broken](missing.md)\n",
+		"htdocs/logo.png": "PNG",
+	}, map[string]any{"dir": "htdocs", "output": "public"})
+
+	stats, err := s.build(false, 2)
+	if err == nil || !strings.Contains(err.Error(), `failed to parse "bad.md": broken link to "missing.md"`) {
+		t.Errorf("Got error %v, want the broken link", err)
+	}
+	if want := (buildStats{generated: 1, copied: 1}); stats != want {
+		t.Errorf("Got %+v, want %+v", stats, want)
+	}
+	for _, name := range []string{"public/index.html", "public/logo.png"} {
+		if _, err := os.Stat(name); err != nil {
+			t.Errorf("Not generated: %v", err)
+		}
+	}
+
+	// The failed page is left out of the manifest, so it is retried.
+	m, err := loadManifest(manifestFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.Outputs["bad.html"]; ok {
+		t.Errorf("Manifest has an entry for the failed page")
+	}
+	if err := os.WriteFile("htdocs/bad.md", []byte("[Home](index.md)\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Pages listing the site are generated again with the fixed page.
+	stats, err = s.build(false, 2)
+	if err != nil {
+		t.Fatalf("Got error: %+v", err)
+	}
+	if want := (buildStats{generated: 2, unchanged: 1}); stats != want {
+		t.Errorf("Got %+v, want %+v", stats, want)
+	}
+}
+
+func TestBuildSite(t *testing.T) {
+	s := testSite(t, map[string]string{
+		"outline.tmpl":      "<< .Body >>{{range .Site}}{{range .TOC}}<p>{{.Text}}</p>{{end}}{{end}}",
+		"htdocs/index.md":   "# Home\n\n{{sitetoc}}\n",
+		"htdocs/outline.md": "---\nstyle: outline\n---\n# Outline\n",
+		"htdocs/plain.md":   "# Plain\n",
+		"htdocs/a.md":       "# Old\n",
+	}, map[string]any{"dir": "htdocs", "output": "public", "templates": []string{"outline.tmpl"}})
+	if _, err := s.build(false, 2); err != nil {
+		t.Fatalf("Got error: %+v", err)
+	}
+
+	// Only the pages using the headings of the site are generated again
+	// when a heading changes.
+	if err := os.WriteFile("htdocs/a.md", []byte("# New\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := s.build(false, 2)
+	if err != nil {
+		t.Fatalf("Got error: %+v", err)
+	}
+	if want := (buildStats{generated: 2, unchanged: 2}); stats != want {
+		t.Errorf("Got %+v, want %+v", stats, want)
+	}
+	if buf, err := os.ReadFile("public/outline.html"); err != nil || !strings.Contains(string(buf), "<p>New</p>") {
+		t.Errorf("Got outline %q, %v", buf, err)
+	}
+
+	// Pages listing the site are generated again when a page is added.
+	if err := os.WriteFile("htdocs/b.md", []byte("# B\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stats, err = s.build(false, 2)
+	if err != nil {
+		t.Fatalf("Got error: %+v", err)
+	}
+	if want := (buildStats{generated: 3, unchanged: 2}); stats != want {
+		t.Errorf("Got %+v, want %+v", stats, want)
+	}
+}
+
+func TestBuildOutput(t *testing.T) {
+	files := map[string]string{
+		"htdocs/index.md":            "# Home\n",
+		"htdocs/blog/_defaults.yaml": "author: Blog\n",
+		"htdocs/blog/a.md":           "# A\n",
+		"htdocs/logo.png":            "PNG",
+		"htdocs/hand.html":           "<p>Hand</p>",
+	}
+	// The output directory is within 'dir', and must not be read back.
+	s := testSite(t, files, map[string]any{"dir": "htdocs", "output": "htdocs/public"})
+
+	pages, assets, err := s.files()
+	if err != nil {
+		t.Fatalf("Got error: %+v", err)
+	}
+	if want := []string{filepath.Join("blog", "a.md"), "index.md"}; !reflect.DeepEqual(pages, want) {
+		t.Errorf("Got pages %q, want %q", pages, want)
+	}
+	if want := []string{"hand.html", "logo.png"}; !reflect.DeepEqual(assets, want) {
+		t.Errorf("Got assets %q, want %q", assets, want)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := s.build(true, 2); err != nil {
+			t.Fatalf("Got error: %+v", err)
+		}
+	}
+	for name, want := range map[string]string{
+		"htdocs/public/index.html":  "<h1 id=\"home\">Home</h1>",
+		"htdocs/public/blog/a.html": "<h1 id=\"a\">A</h1>",
+		"htdocs/public/logo.png":    "PNG",
+		"htdocs/public/hand.html":   "<p>Hand</p>",
+	} {
+		buf, err := os.ReadFile(name)
+		if err != nil {
+			t.Errorf("Not generated: %v", err)
+		} else if !strings.Contains(string(buf), want) {
+			t.Errorf("%s does not contain %q:\n%s", name, want, buf)
+		}
+	}
+	for _, name := range []string{
+		"htdocs/public/blog/_defaults.yaml",
+		"htdocs/public/public",
+		"htdocs/index.html",
+		"htdocs/blog/a.html",
+	} {
+		if _, err := os.Stat(name); err == nil {
+			t.Errorf("%s was written", name)
+		}
+	}
+	for name, want := range files {
+		if buf, err := os.ReadFile(name); err != nil || string(buf) != want {
+			t.Errorf("Source %s changed: %q, %v", name, buf, err)
+		}
+	}
+}
+
+func TestOutputDir(t *testing.T) {
+	for _, tt := range []struct {
+		config map[string]any
+		want   string
+	}{
+		{map[string]any{"dir": "htdocs"}, "htdocs"},
+		{map[string]any{"dir": "htdocs", "output": "public/"}, "public"},
+		{map[string]any{}, ""},
+	} {
+		viper.Reset()
+		for key, value := range tt.config {
+			viper.Set(key, value)
+		}
+		// publish uploads the files of this directory.
+		got, err := outputDir()
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("outputDir() = %q for %v, want an error", got, tt.config)
+			}
+		} else if err != nil || got != tt.want {
+			t.Errorf("outputDir() = %q, %v for %v, want %q", got, err, tt.config, tt.want)
+		}
+	}
+	viper.Reset()
+}
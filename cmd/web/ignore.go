@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// ignoreFile is the name of the file, in the site directory, that lists
+// extra patterns of files to ignore.
+const ignoreFile = ".webignore"
+
+// defaultIgnore are the patterns of files that are ignored, unless the
+// 'ignore' key of the config file sets others.
+var defaultIgnore = []string{"*.swp", ".DS_Store", "_drafts/", "*.tmpl"}
+
+// ignorePatterns returns the patterns of the files that generate ignores:
+// the 'ignore' list of the config file (or defaultIgnore), along with those
+// listed in the ignore file, if any.
+func ignorePatterns() ([]string, error) {
+	patterns := defaultIgnore
+	if viper.IsSet("ignore") {
+		patterns = viper.GetStringSlice("ignore")
+	}
+	extra, err := readIgnoreFile(ignoreFile)
+	if err != nil {
+		return nil, err
+	}
+	patterns = append(append([]string(nil), patterns...), extra...)
+
+	for _, pattern := range patterns {
+		if _, err := path.Match(strings.Trim(pattern, "/"), ""); err != nil {
+			return nil, fmt.Errorf("invalid ignore pattern %q: %w", pattern, err)
+		}
+	}
+	return patterns, nil
+}
+
+// readIgnoreFile returns the patterns listed in the file at name, one per
+// line. Empty lines and lines starting with "#" are skipped.
+func readIgnoreFile(name string) ([]string, error) {
+	buf, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var patterns []string
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns, scanner.Err()
+}
+
+// ignored reports whether the file (or directory, if dir is set) at relpath,
+// relative to the site's root, matches any of patterns.
+//
+// A pattern such as "*.swp" matches the name of a file in any directory, a
+// pattern containing a "/", such as "blog/old-*.md", matches the path from
+// the site's root, and a pattern ending with "/", such as "_drafts/", only
+// matches directories.
+func ignored(patterns []string, relpath string, dir bool) bool {
+	relpath = filepath.ToSlash(relpath)
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, "/") {
+			if !dir {
+				continue
+			}
+			pattern = strings.TrimSuffix(pattern, "/")
+		}
+		var ok bool
+		if strings.Contains(pattern, "/") {
+			ok, _ = path.Match(strings.TrimPrefix(pattern, "/"), relpath)
+		} else {
+			ok, _ = path.Match(pattern, path.Base(relpath))
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
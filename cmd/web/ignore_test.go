@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestIgnored(t *testing.T) {
+	patterns := append(append([]string(nil), defaultIgnore...), "blog/old-*.md", "/secret.txt")
+	tests := []struct {
+		path string
+		dir  bool
+		want bool
+	}{
+		{"index.md", false, false},
+		{"blog/.index.md.swp", false, true},
+		{".DS_Store", false, true},
+		{"img/.DS_Store", false, true},
+		{"_drafts", true, true},
+		{"blog/_drafts", true, true},
+		{"_drafts", false, false},
+		{"article.tmpl", false, true},
+		{"blog/old-post.md", false, true},
+		{"old-post.md", false, false},
+		{"secret.txt", false, true},
+		{"blog/secret.txt", false, false},
+	}
+	for _, tt := range tests {
+		if got := ignored(patterns, filepath.FromSlash(tt.path), tt.dir); got != tt.want {
+			t.Errorf("ignored(%q, dir=%v) = %v, want %v", tt.path, tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestReadIgnoreFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), ignoreFile)
+	if err := os.WriteFile(name, []byte("# Comment\n*.bak\n\n  tmp/  \n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readIgnoreFile(name)
+	if err != nil {
+		t.Fatalf("Got error: %+v", err)
+	}
+	if want := []string{"*.bak", "tmp/"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %q, want %q", got, want)
+	}
+
+	got, err = readIgnoreFile(filepath.Join(t.TempDir(), "missing"))
+	if err != nil || got != nil {
+		t.Errorf("Got %q, %v for a missing file", got, err)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// brokenLink is a link, within a generated page, that points nowhere.
+type brokenLink struct {
+	page   string // relative to the site's root
+	link   string
+	reason string
+}
+
+func (b brokenLink) String() string {
+	return fmt.Sprintf("%s: %q (%s)", b.page, b.link, b.reason)
+}
+
+// linkChecker checks the internal links of the HTML pages of a site.
+type linkChecker struct {
+	root string
+
+	// The ids of the elements of each page read so far, by path relative to
+	// root, or nil if the page could not be read.
+	ids map[string]map[string]bool
+
+	// The external (http and https) links found so far, along with the pages
+	// they were found in.
+	external map[string][]string
+}
+
+func newLinkChecker(root string) *linkChecker {
+	return &linkChecker{
+		root:     root,
+		ids:      make(map[string]map[string]bool),
+		external: make(map[string][]string),
+	}
+}
+
+// readPage parses the HTML page at pagepath (relative to the root), and
+// records the ids of its elements.
+func (c *linkChecker) readPage(pagepath string) (*goquery.Document, error) {
+	f, err := os.Open(filepath.Join(c.root, filepath.FromSlash(pagepath)))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	doc, err := goquery.NewDocumentFromReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %q: %w", pagepath, err)
+	}
+	ids := make(map[string]bool)
+	doc.Find("[id]").Each(func(_ int, sel *goquery.Selection) {
+		ids[sel.AttrOr("id", "")] = true
+	})
+	doc.Find("a[name]").Each(func(_ int, sel *goquery.Selection) {
+		ids[sel.AttrOr("name", "")] = true
+	})
+	c.ids[pagepath] = ids
+	return doc, nil
+}
+
+// pageIDs returns the ids of the elements of the page at pagepath, reading
+// it if needed.
+func (c *linkChecker) pageIDs(pagepath string) (map[string]bool, error) {
+	if ids, ok := c.ids[pagepath]; ok {
+		return ids, nil
+	}
+	if _, err := c.readPage(pagepath); err != nil {
+		return nil, err
+	}
+	return c.ids[pagepath], nil
+}
+
+// check returns the broken internal links of the HTML page at pagepath
+// (relative to the root): links to pages, images and other files that do
+// not exist, and fragments that point to no element id. Links with a scheme
+// or host, such as "https://example.com/", are not checked, but http and
+// https links are recorded to be checked by an externalChecker.
+func (c *linkChecker) check(pagepath string) ([]brokenLink, error) {
+	pagepath = filepath.ToSlash(pagepath)
+	doc, err := c.readPage(pagepath)
+	if err != nil {
+		return nil, err
+	}
+
+	var broken []brokenLink
+	doc.Find("[href], [src]").Each(func(_ int, sel *goquery.Selection) {
+		for _, attr := range []string{"href", "src"} {
+			link, ok := sel.Attr(attr)
+			if !ok {
+				continue
+			}
+			if reason := c.checkLink(pagepath, link, goquery.NodeName(sel)); reason != "" {
+				broken = append(broken, brokenLink{page: pagepath, link: link, reason: reason})
+			}
+		}
+	})
+	return broken, nil
+}
+
+// checkLink checks a link found in an element of the page at pagepath, and
+// returns the reason it is broken, or the empty string.
+func (c *linkChecker) checkLink(pagepath, link, element string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return "invalid URL"
+	}
+	if u.Scheme != "" || u.Host != "" {
+		if u.Scheme == "http" || u.Scheme == "https" {
+			pages := c.external[link]
+			if len(pages) == 0 || pages[len(pages)-1] != pagepath {
+				c.external[link] = append(pages, pagepath)
+			}
+		}
+		return ""
+	}
+
+	target := pagepath
+	if u.Path != "" {
+		if strings.HasPrefix(u.Path, "/") {
+			target = path.Clean(strings.TrimPrefix(u.Path, "/"))
+		} else {
+			target = path.Join(path.Dir(pagepath), u.Path)
+		}
+		if target == ".." || strings.HasPrefix(target, "../") {
+			return "outside of the site"
+		}
+		info, err := os.Stat(filepath.Join(c.root, filepath.FromSlash(target)))
+		if err == nil && info.IsDir() {
+			target = path.Join(target, "index.html")
+			_, err = os.Stat(filepath.Join(c.root, filepath.FromSlash(target)))
+		}
+		if err != nil {
+			if element == "img" {
+				return "image not found"
+			}
+			return "page not found"
+		}
+	}
+
+	if u.Fragment == "" || u.Fragment == "top" || path.Ext(target) != ".html" {
+		return ""
+	}
+	ids, err := c.pageIDs(target)
+	if err != nil {
+		return "page not readable"
+	}
+	if !ids[u.Fragment] {
+		return "anchor not found"
+	}
+	return ""
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeFiles writes files, by path relative to root, into root.
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLinkChecker(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"index.html": `<h1 id="top-heading">Home</h1>
+<a href="blog/a.html#usage">ok</a>
+<a href="blog/#usage">ok, directory</a>
+<a href="/blog/a.html">ok, site root</a>
+<a href="#top-heading">ok, same page</a>
+<a href="#top">ok, top</a>
+<a href="https://example.com/missing.html">ok, external</a>
+<a href="mailto:someone@example.com">ok, mail</a>
+<img src="logo.png">
+<a href="blog/b.html">missing page</a>
+<a href="blog/a.html#nope">missing anchor</a>
+<a href="#nope">missing anchor, same page</a>
+<img src="missing.png">
+<a href="../outside.html">outside</a>`,
+		"logo.png":        "",
+		"blog/a.html":     `<h2 id="usage">Usage</h2><a name="old"></a><a href="../index.html#top-heading">ok</a><a href="#old">ok</a>`,
+		"blog/index.html": `<h2 id="usage">Usage</h2>`,
+	})
+
+	checker := newLinkChecker(root)
+	var got []brokenLink
+	for _, page := range []string{"index.html", "blog/a.html", "blog/index.html"} {
+		broken, err := checker.check(page)
+		if err != nil {
+			t.Fatalf("Got error: %+v", err)
+		}
+		got = append(got, broken...)
+	}
+	want := []brokenLink{
+		{"index.html", "blog/b.html", "page not found"},
+		{"index.html", "blog/a.html#nope", "anchor not found"},
+		{"index.html", "#nope", "anchor not found"},
+		{"index.html", "missing.png", "image not found"},
+		{"index.html", "../outside.html", "outside of the site"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got broken links:\n%v\nwant:\n%v", got, want)
+	}
+}
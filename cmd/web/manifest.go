@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/nuttyswiss/ktw"
+)
+
+// manifestFile is the path, within the site directory, of the build manifest.
+const manifestFile = ".web/manifest.json"
+
+// manifest records, for each generated file, the hashes of the inputs it was
+// generated from, so that generate only rebuilds the files whose inputs have
+// changed.
+type manifest struct {
+	path string
+
+	// Outputs holds an entry per generated file, by path relative to the
+	// output directory.
+	Outputs map[string]manifestEntry `json:"outputs"`
+}
+
+// manifestEntry holds the inputs of a generated file.
+type manifestEntry struct {
+	// Inputs holds the SHA-256 hash of each input file, by path: the source,
+	// its default frontmatter files, its template and the config file.
+	Inputs map[string]string `json:"inputs"`
+	// Site is the hash of the list of pages of the site, as available to
+	// templates, if the file is a page.
+	Site string `json:"site,omitempty"`
+}
+
+// loadManifest reads the manifest at path. A missing manifest is empty.
+func loadManifest(path string) (*manifest, error) {
+	m := &manifest{path: path, Outputs: make(map[string]manifestEntry)}
+	buf, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(buf, m); err != nil {
+		return nil, fmt.Errorf("failed to parse %q: %w", path, err)
+	}
+	if m.Outputs == nil {
+		m.Outputs = make(map[string]manifestEntry)
+	}
+	return m, nil
+}
+
+// save writes the manifest.
+func (m *manifest) save() error {
+	buf, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(m.path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(m.path, append(buf, '\n'), 0644)
+}
+
+// changed returns why the file at dstpath must be generated again, given the
+// entry for its current inputs, or the empty string if it is up to date. It
+// reports whether the manifest has an entry for dstpath at all.
+func (m *manifest) changed(dstpath string, entry manifestEntry) (string, bool) {
+	old, ok := m.Outputs[dstpath]
+	if !ok {
+		return "not built yet", false
+	}
+	var inputs []string
+	for input := range entry.Inputs {
+		inputs = append(inputs, input)
+	}
+	sort.Strings(inputs)
+	for _, input := range inputs {
+		if old.Inputs[input] != entry.Inputs[input] {
+			return fmt.Sprintf("%s changed", input), true
+		}
+	}
+	if len(old.Inputs) != len(entry.Inputs) {
+		return "inputs changed", true
+	}
+	if old.Site != entry.Site {
+		return "site pages changed", true
+	}
+	return "", true
+}
+
+// hashFile returns the SHA-256 hash of the file at path.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashInputs returns the manifest entry for a file generated from inputs.
+func hashInputs(inputs []string) (manifestEntry, error) {
+	entry := manifestEntry{Inputs: make(map[string]string, len(inputs))}
+	for _, input := range inputs {
+		hash, err := hashFile(input)
+		if err != nil {
+			return manifestEntry{}, err
+		}
+		entry.Inputs[input] = hash
+	}
+	return entry, nil
+}
+
+// siteHashes are the hashes of the pages of the site, as available to pages
+// with each siteUse. Pages are generated again when the part of the site
+// they use changes.
+type siteHashes [siteFull + 1]string
+
+// hashSite returns the hashes of the pages of the site: of their titles and
+// URLs, as listed by {{sitetoc}}, and of their tables of contents too, as
+// available as .Site. Pages that do not use the site have no hash.
+func hashSite(toc ktw.SiteTOC) siteHashes {
+	list, full := sha256.New(), sha256.New()
+	for _, page := range toc {
+		fmt.Fprintf(list, "%q %q\n", page.Title, page.URL)
+		fmt.Fprintf(full, "%q %q\n", page.Title, page.URL)
+		hashTOC(full, page.TOC)
+	}
+	return siteHashes{
+		siteList: hex.EncodeToString(list.Sum(nil)),
+		siteFull: hex.EncodeToString(full.Sum(nil)),
+	}
+}
+
+// hashTOC writes the headings of toc, and of their children, to w.
+func hashTOC(w io.Writer, toc ktw.TOC) {
+	for _, entry := range toc {
+		fmt.Fprintf(w, "\t%d %q %q\n", entry.Level, entry.ID, entry.Text)
+		hashTOC(w, entry.Children)
+	}
+}
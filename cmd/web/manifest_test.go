@@ -0,0 +1,121 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/nuttyswiss/ktw"
+)
+
+func TestManifest(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "index.md")
+	tmpl := filepath.Join(dir, "article.tmpl")
+	for _, name := range []string{src, tmpl} {
+		if err := os.WriteFile(name, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entry, err := hashInputs([]string{src, tmpl})
+	if err != nil {
+		t.Fatalf("Got error: %+v", err)
+	}
+	entry.Site = "site"
+
+	m, err := loadManifest(filepath.Join(dir, manifestFile))
+	if err != nil {
+		t.Fatalf("Got error: %+v", err)
+	}
+	if reason, ok := m.changed("index.html", entry); ok || reason != "not built yet" {
+		t.Errorf("Got %q, %v for an empty manifest", reason, ok)
+	}
+	m.Outputs["index.html"] = entry
+	if err := m.save(); err != nil {
+		t.Fatalf("Got error: %+v", err)
+	}
+
+	m, err = loadManifest(filepath.Join(dir, manifestFile))
+	if err != nil {
+		t.Fatalf("Got error: %+v", err)
+	}
+	if reason, ok := m.changed("index.html", entry); !ok || reason != "" {
+		t.Errorf("Got %q, %v for an unchanged file", reason, ok)
+	}
+
+	site := entry
+	site.Site = "other"
+	if reason, _ := m.changed("index.html", site); reason != "site pages changed" {
+		t.Errorf("Got %q for a changed site", reason)
+	}
+
+	if err := os.WriteFile(tmpl, []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := hashInputs([]string{src, tmpl})
+	if err != nil {
+		t.Fatalf("Got error: %+v", err)
+	}
+	changed.Site = "site"
+	if reason, _ := m.changed("index.html", changed); reason != tmpl+" changed" {
+		t.Errorf("Got %q for a changed template", reason)
+	}
+
+	fewer, err := hashInputs([]string{src})
+	if err != nil {
+		t.Fatalf("Got error: %+v", err)
+	}
+	fewer.Site = "site"
+	if reason, _ := m.changed("index.html", fewer); reason != "inputs changed" {
+		t.Errorf("Got %q for fewer inputs", reason)
+	}
+}
+
+func TestHashSite(t *testing.T) {
+	site := func(heading string) ktw.SiteTOC {
+		return ktw.SiteTOC{{
+			Title: "Home",
+			URL:   "/index.html",
+			TOC: ktw.TOC{{Level: 1, Text: "Home", ID: "home", Children: ktw.TOC{
+				{Level: 2, Text: heading, ID: "usage"},
+			}}},
+		}}
+	}
+	if hashSite(site("Usage")) != hashSite(site("Usage")) {
+		t.Errorf("Got different hashes for the same site")
+	}
+	usage, howto := hashSite(site("Usage")), hashSite(site("How to use"))
+	if usage[siteFull] == howto[siteFull] {
+		t.Errorf("Got the same hash of .Site for a changed heading")
+	}
+	if usage[siteList] != howto[siteList] {
+		t.Errorf("Got a different hash of {{sitetoc}} for a changed heading")
+	}
+	if usage[siteUnused] != "" {
+		t.Errorf("Got hash %q for pages not using the site", usage[siteUnused])
+	}
+}
+
+func TestTemplateInputs(t *testing.T) {
+	s := testSite(t, map[string]string{
+		"article.tmpl":    `<< template "nav.tmpl" >><< .Body >>`,
+		"nav.tmpl":        `<nav></nav>`,
+		"htdocs/index.md": "---\nstyle: article\n---\n# Home\n",
+		"htdocs/plain.md": "# Plain\n",
+	}, map[string]any{"dir": "htdocs", "templates": []string{"article.tmpl", "nav.tmpl"}})
+	src, err := s.readSource("index.md")
+	if err != nil {
+		t.Fatalf("Got error: %+v", err)
+	}
+	if want := []string{filepath.Join("htdocs", "index.md"), "article.tmpl", "nav.tmpl"}; !reflect.DeepEqual(src.inputs, want) {
+		t.Errorf("Got inputs %q, want %q", src.inputs, want)
+	}
+	src, err = s.readSource("plain.md")
+	if err != nil {
+		t.Fatalf("Got error: %+v", err)
+	}
+	if want := []string{filepath.Join("htdocs", "plain.md")}; !reflect.DeepEqual(src.inputs, want) {
+		t.Errorf("Got inputs %q, want %q", src.inputs, want)
+	}
+}
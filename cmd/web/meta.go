@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+func init() {
+	var cmd = &cobra.Command{
+		Use:   "meta <path>",
+		Short: "Print the effective metadata of a page",
+		Args:  cobra.ExactArgs(1),
+		RunE:  meta,
+	}
+	cli.AddCommand(cmd)
+}
+
+// meta prints the metadata of the page at path, after merging the page's
+// frontmatter onto the defaults of its directory. The path may be given
+// relative to the site, or relative to the site's 'dir'.
+func meta(cmd *cobra.Command, args []string) error {
+	s, err := newSite()
+	if err != nil {
+		return err
+	}
+
+	srcpath := filepath.Clean(args[0])
+	if rel, err := filepath.Rel(s.root, srcpath); err == nil && !strings.HasPrefix(rel, "..") {
+		srcpath = rel
+	}
+	src, err := s.readSource(srcpath)
+	if err != nil {
+		return err
+	}
+
+	buf, err := yaml.Marshal(src.metadata)
+	if err != nil {
+		return err
+	}
+	for _, file := range src.defaults {
+		fmt.Printf("# defaults: %s\n", file)
+	}
+	fmt.Print(string(buf))
+	return nil
+}
@@ -175,12 +175,12 @@ func publish(cmd *cobra.Command, args []string) error {
 	defer endpoint.Close()
 	client := endpoint.Client()
 
-	// Specify the source directory to upload
-	root := viper.GetString("dir")
-	if root == "" {
-		return fmt.Errorf("config is missing 'dir' key")
+	// Upload the generated site: the 'output' directory, if set.
+	root, err := outputDir()
+	if err != nil {
+		return err
 	}
-	fmt.Printf("Generating from %s\n", root)
+	fmt.Printf("Publishing from %s\n", root)
 
 	cwd, err := client.Getwd()
 	if err != nil {
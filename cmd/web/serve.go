@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	var cmd = &cobra.Command{
+		Use:   "serve",
+		Short: "Serve the website, regenerating it as it changes",
+		RunE:  serve,
+	}
+	cmd.Flags().String("addr", "localhost:8080", "address to listen on")
+	cmd.Flags().IntP("jobs", "j", runtime.GOMAXPROCS(0), "number of files to generate in parallel")
+	cli.AddCommand(cmd)
+}
+
+// eventsPath is the URL path of the stream of reload events, as listened to
+// by the script injected into the served pages.
+const eventsPath = "/_web/events"
+
+// reloadScript is injected into every HTML page served, to reload the page
+// when the site is regenerated.
+const reloadScript = `<script>new EventSource("` + eventsPath + `").onmessage = () => location.reload();</script>
+`
+
+// errorOverlay is injected into every HTML page served after a failed build,
+// with the escaped error.
+const errorOverlay = `<div id="web-error" style="position: fixed; inset: 0; z-index: 2147483647; overflow: auto; margin: 0; padding: 2em; background: rgba(24, 24, 24, 0.95); color: #ff8080; font: 14px/1.5 monospace; white-space: pre-wrap;">%s</div>
+`
+
+// serve generates the site, serves its output directory over HTTP, and
+// watches the site for changes. On every change the site is generated again
+// (only the pages whose inputs changed are rendered) and the pages open in a
+// browser are reloaded. The reload script is injected into the pages as they
+// are served, so the generated files are left as generate would write them.
+// A failed build is shown as an overlay on every page, rather than stopping
+// the server.
+func serve(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("serve takes no arguments")
+	}
+	addr, _ := cmd.Flags().GetString("addr")
+	jobs, _ := cmd.Flags().GetInt("jobs")
+	if jobs < 1 {
+		return fmt.Errorf("--jobs must be at least 1")
+	}
+	s, err := newSite()
+	if err != nil {
+		return err
+	}
+	srv := &server{site: s, jobs: jobs, reloads: newReloader()}
+	srv.rebuild(false)
+
+	w, err := newWatcher(srv.triggers, s.watchDirs()...)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	hs := &http.Server{Addr: addr, Handler: srv}
+	errc := make(chan error, 2)
+	go func() {
+		errc <- w.run(ctx, func(paths []string) {
+			fmt.Printf("Changed: %s\n", strings.Join(paths, ", "))
+			srv.rebuild(true)
+		})
+	}()
+	go func() {
+		errc <- hs.ListenAndServe()
+	}()
+	fmt.Printf("Serving %s on http://%s/\n", s.output, addr)
+
+	select {
+	case err = <-errc:
+	case <-ctx.Done():
+	}
+	stop()
+	shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	srv.reloads.close()
+	if err := hs.Shutdown(shutdown); err != nil {
+		return err
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// server serves the output directory of a site, injecting the reload script
+// (and the error of the last build, if any) into HTML pages.
+type server struct {
+	jobs    int
+	reloads *reloader
+
+	mu   sync.Mutex
+	site *site
+	err  error // of the last build
+}
+
+// rebuild generates the site again, reading the config file again if reload
+// is set, and reloads the pages open in browsers.
+func (srv *server) rebuild(reload bool) {
+	err := srv.build(reload)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+	}
+	srv.mu.Lock()
+	srv.err = err
+	srv.mu.Unlock()
+	if reload {
+		srv.reloads.reload()
+	}
+}
+
+func (srv *server) build(reload bool) error {
+	s := srv.current()
+	if reload {
+		var err error
+		if s, err = reloadSite(); err != nil {
+			return err
+		}
+		srv.mu.Lock()
+		srv.site = s
+		srv.mu.Unlock()
+	}
+	stats, err := s.build(false, srv.jobs)
+	if err != nil {
+		return err
+	}
+	fmt.Println(stats)
+	return nil
+}
+
+// current returns the site being served.
+func (srv *server) current() *site {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return srv.site
+}
+
+// triggers implements the triggers func of a watcher, for the site being
+// served.
+func (srv *server) triggers(path string, dir bool) bool {
+	return srv.current().triggers(path, dir)
+}
+
+// ServeHTTP implements http.Handler.
+func (srv *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	urlpath := path.Clean("/" + r.URL.Path)
+	if urlpath == eventsPath {
+		srv.reloads.ServeHTTP(w, r)
+		return
+	}
+
+	srv.mu.Lock()
+	output, buildErr := srv.site.output, srv.err
+	srv.mu.Unlock()
+
+	name := filepath.Join(output, filepath.FromSlash(urlpath))
+	if info, err := os.Stat(name); err == nil && info.IsDir() && strings.HasSuffix(r.URL.Path, "/") {
+		name = filepath.Join(name, "index.html")
+	}
+	if filepath.Ext(name) != ".html" {
+		http.FileServer(http.Dir(output)).ServeHTTP(w, r)
+		return
+	}
+
+	status := http.StatusOK
+	buf, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		// Still injected, so the page is shown once it is generated.
+		status = http.StatusNotFound
+		buf = []byte("<html><body><p>404 page not found</p></body></html>\n")
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(inject(buf, buildErr))
+}
+
+// inject returns the HTML page buf with the reload script, and the overlay
+// showing err (if not nil), inserted before its closing body tag, or at its
+// end if it has none.
+func inject(buf []byte, err error) []byte {
+	snippet := reloadScript
+	if err != nil {
+		snippet = fmt.Sprintf(errorOverlay, html.EscapeString(err.Error())) + snippet
+	}
+	i := bytes.LastIndex(bytes.ToLower(buf), []byte("</body>"))
+	if i < 0 {
+		i = len(buf)
+	}
+	out := make([]byte, 0, len(buf)+len(snippet))
+	out = append(out, buf[:i]...)
+	out = append(out, snippet...)
+	return append(out, buf[i:]...)
+}
+
+// reloader streams reload events to the pages open in browsers, as
+// Server-Sent Events.
+type reloader struct {
+	mu      sync.Mutex
+	clients map[chan struct{}]bool
+	closed  chan struct{}
+}
+
+func newReloader() *reloader {
+	return &reloader{clients: make(map[chan struct{}]bool), closed: make(chan struct{})}
+}
+
+// reload sends a reload event to every page.
+func (r *reloader) reload() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for c := range r.clients {
+		select {
+		case c <- struct{}{}:
+		default: // A reload is already pending.
+		}
+	}
+}
+
+// close ends the streams of every page.
+func (r *reloader) close() {
+	close(r.closed)
+}
+
+// ServeHTTP implements http.Handler, streaming the reload events to a page.
+func (r *reloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	c := make(chan struct{}, 1)
+	r.mu.Lock()
+	r.clients[c] = true
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.clients, c)
+		r.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-r.closed:
+			return
+		case <-c:
+			fmt.Fprint(w, "data: reload\n\n")
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInject(t *testing.T) {
+	tests := []struct {
+		page string
+		err  error
+		want string
+	}{
+		{"<html><body><p>Hi</p></body></html>", nil, "<html><body><p>Hi</p>" + reloadScript + "</body></html>"},
+		{"<HTML><BODY>Hi</BODY></HTML>", nil, "<HTML><BODY>Hi" + reloadScript + "</BODY></HTML>"},
+		{"<p>Hi</p>", nil, "<p>Hi</p>" + reloadScript},
+	}
+	for _, tt := range tests {
+		if got := string(inject([]byte(tt.page), tt.err)); got != tt.want {
+			t.Errorf("inject(%q) = %q, want %q", tt.page, got, tt.want)
+		}
+	}
+
+	got := string(inject([]byte("<body></body>"), errors.New(`broken link to "<a>"`)))
+	for _, want := range []string{`<div id="web-error"`, `broken link to &#34;&lt;a&gt;&#34;</div>`, reloadScript + "</body>"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Output does not contain %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestServer(t *testing.T) {
+	output := t.TempDir()
+	writeFiles(t, output, map[string]string{
+		"index.html":      "<html><body>Home</body></html>",
+		"blog/index.html": "<html><body>Blog</body></html>",
+		"logo.png":        "PNG",
+	})
+	srv := &server{site: &site{output: output}, reloads: newReloader()}
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+
+	tests := []struct {
+		path   string
+		status int
+		want   string
+	}{
+		{"/", http.StatusOK, "Home" + reloadScript},
+		{"/index.html", http.StatusOK, "Home" + reloadScript},
+		{"/blog/", http.StatusOK, "Blog" + reloadScript},
+		{"/logo.png", http.StatusOK, "PNG"},
+		{"/missing.html", http.StatusNotFound, "404 page not found</p>" + reloadScript},
+	}
+	for _, tt := range tests {
+		resp, err := http.Get(ts.URL + tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.status || !strings.Contains(string(body), tt.want) {
+			t.Errorf("GET %s = %d %q, want %d with %q", tt.path, resp.StatusCode, body, tt.status, tt.want)
+		}
+		if tt.path == "/logo.png" && strings.Contains(string(body), "<script>") {
+			t.Errorf("GET %s has the reload script", tt.path)
+		}
+	}
+
+	srv.err = errors.New("failed to render")
+	resp, err := http.Get(ts.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), "failed to render</div>") {
+		t.Errorf("Error not shown:\n%s", body)
+	}
+	if buf, _ := os.ReadFile(filepath.Join(output, "index.html")); strings.Contains(string(buf), "<script>") {
+		t.Errorf("Generated file was changed: %s", buf)
+	}
+}
+
+func TestReloader(t *testing.T) {
+	r := newReloader()
+	ts := httptest.NewServer(r)
+	t.Cleanup(ts.Close)
+	t.Cleanup(r.close)
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Got content type %q", ct)
+	}
+	// The headers are only sent once the client is registered.
+	r.reload()
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "data: reload\n" {
+		t.Errorf("Got event %q", line)
+	}
+}
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/nuttyswiss/ktw"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// Names of the files that hold the default frontmatter of a directory.
+const (
+	defaultsFile = "_defaults.yaml"
+	indexFile    = "_index.md"
+)
+
+// site holds the configuration of the website being worked on, as read from
+// the config file.
+type site struct {
+	root      string   // the 'dir' holding the site's content
+	output    string   // the directory the site is generated into
+	ignore    []string // patterns of the files to ignore
+	tmplPaths []string
+	templates *template.Template
+	tmplUse   siteUse // how the templates use the pages of the site
+	engine    *ktw.MarkdownEngine
+
+	// Default frontmatter of each directory, by path relative to root. The
+	// mutex allows sources to be read concurrently.
+	mu       sync.Mutex
+	defaults map[string]*defaults
+}
+
+// defaults is the merged default frontmatter of a directory, along with the
+// files (including those of its ancestors) that it was read from.
+type defaults struct {
+	metadata ktw.Frontmatter
+	files    []string
+}
+
+// source is a Markdown file of the site, parsed and ready to be rendered.
+type source struct {
+	path     string // relative to the site's root
+	title    string
+	doc      *ktw.Document
+	metadata ktw.Frontmatter // frontmatter merged onto the directory defaults
+	tmpl     *template.Template
+	defaults []string        // files the default frontmatter was read from
+	ids      *ktw.HeadingIDs // heading ids of the page, shared with its render
+	siteUse  siteUse         // how the page uses the pages of the site
+
+	// The files the rendered page depends on, including the source itself.
+	inputs []string
+}
+
+// newSite returns the site described by the config file.
+func newSite() (*site, error) {
+	root := viper.GetString("dir")
+	if root == "" {
+		return nil, fmt.Errorf("config is missing 'dir' key")
+	}
+	output, err := outputDir()
+	if err != nil {
+		return nil, err
+	}
+	ignore, err := ignorePatterns()
+	if err != nil {
+		return nil, err
+	}
+	s := &site{
+		root:      filepath.Clean(root),
+		output:    output,
+		ignore:    ignore,
+		tmplPaths: viper.GetStringSlice("templates"),
+		defaults:  make(map[string]*defaults),
+	}
+	engine, err := newEngine(root)
+	if err != nil {
+		return nil, err
+	}
+	s.engine = engine
+	if len(s.tmplPaths) != 0 {
+		tmpl, err := parseTemplates(s.tmplPaths)
+		if err != nil {
+			return nil, err
+		}
+		s.templates = tmpl
+		for _, path := range s.tmplPaths {
+			buf, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			s.tmplUse = max(s.tmplUse, usesSite(buf))
+		}
+	}
+	return s, nil
+}
+
+// siteUse is how a page uses the pages of the site, ordered from none at all
+// to everything templates can see of them.
+type siteUse int
+
+const (
+	siteUnused siteUse = iota
+	siteList           // {{sitetoc}}: the titles and URLs of the pages
+	siteFull           // .Site: the tables of contents of the pages too
+)
+
+// usesSite returns how the Markdown or template buf uses the pages of the
+// site. It errs on the side of use, as in a mere mention of ".Site".
+func usesSite(buf []byte) siteUse {
+	switch {
+	case bytes.Contains(buf, []byte(".Site")):
+		return siteFull
+	case bytes.Contains(buf, []byte("sitetoc")):
+		return siteList
+	}
+	return siteUnused
+}
+
+// reloadSite reads the config file again, and returns the site it describes.
+func reloadSite() (*site, error) {
+	if viper.ConfigFileUsed() != "" {
+		if err := viper.ReadInConfig(); err != nil {
+			return nil, err
+		}
+	}
+	return newSite()
+}
+
+// outputDir returns the directory the site is generated into: the 'output'
+// key of the config file, or the 'dir' key if unset, in which case the
+// generated pages are written alongside their sources.
+func outputDir() (string, error) {
+	if output := viper.GetString("output"); output != "" {
+		return filepath.Clean(output), nil
+	}
+	if root := viper.GetString("dir"); root != "" {
+		return filepath.Clean(root), nil
+	}
+	return "", fmt.Errorf("config is missing 'output' or 'dir' key")
+}
+
+// separate reports whether the site is generated into a separate directory,
+// rather than alongside its sources.
+func (s *site) separate() bool {
+	return s.output != s.root
+}
+
+// files returns the Markdown files of the site, and the other files to copy
+// as they are into the output directory (if separate), relative to the
+// site's root. Ignored files and default frontmatter files are skipped, as
+// is the output directory if it is within the site's root.
+func (s *site) files() (pages, assets []string, err error) {
+	err = filepath.WalkDir(s.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		srcpath, err := filepath.Rel(s.root, path)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path == s.output && s.separate() {
+				return filepath.SkipDir
+			}
+			if srcpath != "." && ignored(s.ignore, srcpath, true) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ignored(s.ignore, srcpath, false) {
+			return nil
+		}
+
+		switch {
+		case filepath.Ext(srcpath) == ".md":
+			pages = append(pages, srcpath)
+		case s.separate() && d.Name() != defaultsFile:
+			assets = append(assets, srcpath)
+		}
+		return nil
+	})
+	return pages, assets, err
+}
+
+// newEngine returns the Markdown engine for the site at root, configured by
+// the optional 'markdown' and 'callouts' sections of the config file. Links
+// to Markdown files are rewritten to the generated HTML files.
+func newEngine(root string) (*ktw.MarkdownEngine, error) {
+	opts := []ktw.EngineOption{
+		ktw.WithLinkRewriting(os.DirFS(root), viper.GetBool("markdown.prettyurls")),
+	}
+	if viper.IsSet("markdown.d2") {
+		opts = append(opts, ktw.WithD2(viper.GetBool("markdown.d2")))
+	}
+	if viper.IsSet("markdown.typographer") {
+		opts = append(opts, ktw.WithTypographer(viper.GetBool("markdown.typographer")))
+	}
+	if viper.IsSet("markdown.unsafe") {
+		opts = append(opts, ktw.WithUnsafeHTML(viper.GetBool("markdown.unsafe")))
+	}
+	if viper.IsSet("markdown.linenumbers") {
+		opts = append(opts, ktw.WithLineNumbers(viper.GetBool("markdown.linenumbers")))
+	}
+	if viper.IsSet("markdown.tabwidth") {
+		opts = append(opts, ktw.WithTabWidth(viper.GetInt("markdown.tabwidth")))
+	}
+	if viper.IsSet("markdown.anchors") {
+		// Either a boolean, or a map with the optional symbol and levels.
+		if enable, ok := viper.Get("markdown.anchors").(bool); !ok || enable {
+			opts = append(opts, ktw.WithHeadingAnchors(
+				viper.GetString("markdown.anchors.symbol"),
+				viper.GetIntSlice("markdown.anchors.levels")...,
+			))
+		}
+	}
+	if viper.IsSet("callouts") {
+		callouts, err := calloutsConfig()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, ktw.WithCallouts(callouts))
+	}
+	return ktw.NewMarkdownEngine(opts...), nil
+}
+
+// calloutsConfig returns the default callouts along with those listed in the
+// 'callouts' section of the config file. A list is used, rather than a map,
+// as the keys of a map would lose their case. Listing a default callout (such
+// as Note) replaces it.
+func calloutsConfig() (map[string]ktw.Callout, error) {
+	var list []struct {
+		Prefix string
+		Class  string
+		Title  string
+		Icon   string
+		Label  string
+	}
+	if err := viper.UnmarshalKey("callouts", &list); err != nil {
+		return nil, fmt.Errorf("invalid 'callouts' config: %w", err)
+	}
+
+	callouts := make(map[string]ktw.Callout, len(ktw.DefaultCallouts)+len(list))
+	for prefix, callout := range ktw.DefaultCallouts {
+		callouts[prefix] = callout
+	}
+	for _, c := range list {
+		if c.Prefix == "" || c.Class == "" {
+			return nil, fmt.Errorf("invalid 'callouts' config: prefix and class are required")
+		}
+		label := ktw.LabelMode(c.Label)
+		switch label {
+		case ktw.LabelKeep, ktw.LabelWrap, ktw.LabelDrop:
+		default:
+			return nil, fmt.Errorf("invalid 'callouts' config: unknown label %q for %q", c.Label, c.Prefix)
+		}
+		callouts[c.Prefix] = ktw.Callout{Class: c.Class, Title: c.Title, Icon: c.Icon, Label: label}
+	}
+	return callouts, nil
+}
+
+func parseTemplates(paths []string) (*template.Template, error) {
+	tmpl, err := template.New("").Delims("<<", ">>").ParseFiles(paths...)
+	if err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// dirDefaults returns the default frontmatter for pages within dir (relative
+// to the site's root). The defaults of each ancestor directory are merged,
+// with those of the nearest directory winning. Within a directory, the
+// frontmatter of "_index.md" wins over "_defaults.yaml".
+func (s *site) dirDefaults(dir string) (*defaults, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.loadDefaults(dir)
+}
+
+// loadDefaults implements dirDefaults, with s.mu held.
+func (s *site) loadDefaults(dir string) (*defaults, error) {
+	if d, ok := s.defaults[dir]; ok {
+		return d, nil
+	}
+
+	d := &defaults{metadata: make(ktw.Frontmatter)}
+	if dir != "." {
+		parent, err := s.loadDefaults(filepath.Dir(dir))
+		if err != nil {
+			return nil, err
+		}
+		d.metadata = parent.metadata
+		d.files = append(d.files, parent.files...)
+	}
+
+	path := filepath.Join(s.root, dir, defaultsFile)
+	buf, err := os.ReadFile(path)
+	if err == nil {
+		var fm ktw.Frontmatter
+		if err := yaml.Unmarshal(buf, &fm); err != nil {
+			return nil, fmt.Errorf("failed to parse %q: %w", path, err)
+		}
+		d.metadata = d.metadata.Merge(fm)
+		d.files = append(d.files, path)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	path = filepath.Join(s.root, dir, indexFile)
+	buf, err = os.ReadFile(path)
+	if err == nil {
+		fm, _, err := ktw.SplitFrontmatter(buf)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %q: %w", path, err)
+		}
+		d.metadata = d.metadata.Merge(fm)
+		d.files = append(d.files, path)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	s.defaults[dir] = d
+	return d, nil
+}
+
+// readSource reads the Markdown file at srcpath (relative to the site's root)
+// and parses it, merging its frontmatter onto the defaults of its directory.
+func (s *site) readSource(srcpath string) (*source, error) {
+	path := filepath.Join(s.root, srcpath)
+	inbuf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	src := &source{path: srcpath, ids: ktw.NewHeadingIDs()}
+	doc, err := s.engine.ParseDocumentContext(src.context(context.Background()), inbuf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %q: %w", srcpath, err)
+	}
+	defs, err := s.dirDefaults(filepath.Dir(srcpath))
+	if err != nil {
+		return nil, err
+	}
+	src.title = filepath.Base(srcpath)
+	src.doc = doc
+	src.metadata = defs.metadata.Merge(doc.Frontmatter)
+	src.defaults = defs.files
+	src.inputs = append([]string{path}, defs.files...)
+	src.siteUse = usesSite(inbuf)
+	if tt := src.metadata.Title(); tt != "" {
+		src.title = tt
+	}
+
+	if tmplName := src.metadata.GetString("style"); tmplName != "" {
+		if s.templates != nil {
+			src.tmpl = s.templates.Lookup(tmplName + ".tmpl")
+		}
+		if src.tmpl == nil {
+			return nil, fmt.Errorf("template %q not found", tmplName+".tmpl")
+		}
+		// All the templates are parsed together, and any of them may be used
+		// by the style's template.
+		src.inputs = append(src.inputs, s.tmplPaths...)
+		src.siteUse = max(src.siteUse, s.tmplUse)
+	}
+	if cfg := viper.ConfigFileUsed(); cfg != "" {
+		src.inputs = append(src.inputs, cfg)
+	}
+	return src, nil
+}
+
+// context returns ctx, carrying the heading ids and the path of the source.
+// Rendering the page of the source with it keeps the ids unique across the
+// page, and resolves relative links against the source.
+func (src *source) context(ctx context.Context) context.Context {
+	ctx = ktw.ContextWithHeadingIDs(ctx, src.ids)
+	return ktw.ContextWithPagePath(ctx, filepath.ToSlash(src.path))
+}
+
+// page returns the page to render for the source.
+func (src *source) page() *ktw.Page {
+	return &ktw.Page{
+		Title:    src.title,
+		Metadata: src.metadata,
+		Contents: []ktw.Renderer{src.doc},
+		Template: src.tmpl,
+	}
+}
+
+// htmlPath returns the path of the HTML file generated from the Markdown file
+// at srcpath.
+func htmlPath(srcpath string) string {
+	return strings.TrimSuffix(srcpath, ".md") + ".html"
+}
+
+// pageURL returns the URL of the HTML file generated from the Markdown file at
+// srcpath. With 'markdown.prettyurls' set, "index.html" files are referred to
+// by their directory.
+func pageURL(srcpath string) string {
+	u := "/" + filepath.ToSlash(htmlPath(srcpath))
+	if viper.GetBool("markdown.prettyurls") {
+		u = strings.TrimSuffix(u, "index.html")
+	}
+	return u
+}
+
+// siteTOC returns the table of contents of the site made of srcs, in order.
+func siteTOC(srcs []*source) ktw.SiteTOC {
+	toc := make(ktw.SiteTOC, 0, len(srcs))
+	for _, src := range srcs {
+		toc = append(toc, &ktw.PageTOC{
+			Title: src.title,
+			URL:   pageURL(src.path),
+			TOC:   src.doc.TOC(),
+		})
+	}
+	return toc
+}
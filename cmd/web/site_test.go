@@ -0,0 +1,108 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nuttyswiss/ktw"
+)
+
+func TestDirDefaults(t *testing.T) {
+	s := testSite(t, map[string]string{
+		"htdocs/_defaults.yaml":      "author: Root\nlang: en\nsocial:\n  site: root\n  card: small\n",
+		"htdocs/index.md":            "# Home\n",
+		"htdocs/blog/_defaults.yaml": "author: Blog\nsection: blog\n",
+		"htdocs/blog/_index.md":      "---\nsection: Blog index\nsocial:\n  card: large\n---\n# Blog\n",
+		"htdocs/blog/2024/post.md":   "---\nauthor: Me\n---\n# Post\n",
+		"htdocs/other/page.md":       "# Page\n",
+	}, map[string]any{"dir": "htdocs"})
+
+	tests := []struct {
+		path     string
+		metadata ktw.Frontmatter
+		defaults []string
+	}{
+		{
+			path:     "index.md",
+			metadata: ktw.Frontmatter{"author": "Root", "lang": "en", "social": ktw.Frontmatter{"site": "root", "card": "small"}},
+			defaults: []string{"_defaults.yaml"},
+		},
+		{
+			// No defaults of its own, so those of the root apply.
+			path:     "other/page.md",
+			metadata: ktw.Frontmatter{"author": "Root", "lang": "en", "social": ktw.Frontmatter{"site": "root", "card": "small"}},
+			defaults: []string{"_defaults.yaml"},
+		},
+		{
+			// The nearest directory wins, "_index.md" wins over
+			// "_defaults.yaml", and the page's own frontmatter wins last.
+			path: "blog/2024/post.md",
+			metadata: ktw.Frontmatter{
+				"author":  "Me",
+				"lang":    "en",
+				"section": "Blog index",
+				"social":  ktw.Frontmatter{"site": "root", "card": "large"},
+			},
+			defaults: []string{"_defaults.yaml", "blog/_defaults.yaml", "blog/_index.md"},
+		},
+	}
+	for _, tt := range tests {
+		src, err := s.readSource(tt.path)
+		if err != nil {
+			t.Fatalf("Got error: %+v", err)
+		}
+		if !reflect.DeepEqual(normalize(src.metadata), normalize(tt.metadata)) {
+			t.Errorf("%s: got metadata %v, want %v", tt.path, src.metadata, tt.metadata)
+		}
+		var want []string
+		for _, file := range tt.defaults {
+			want = append(want, filepath.Join("htdocs", filepath.FromSlash(file)))
+		}
+		if !reflect.DeepEqual(src.defaults, want) {
+			t.Errorf("%s: got defaults %q, want %q", tt.path, src.defaults, want)
+		}
+	}
+
+	// meta accepts paths relative to the site, or to its 'dir'.
+	for _, path := range []string{"blog/2024/post.md", "htdocs/blog/2024/post.md"} {
+		if err := meta(nil, []string{path}); err != nil {
+			t.Errorf("meta(%q) returned error: %+v", path, err)
+		}
+	}
+}
+
+func TestDirDefaultsErrors(t *testing.T) {
+	s := testSite(t, map[string]string{
+		"htdocs/yaml/_defaults.yaml": "author: [bad\n",
+		"htdocs/yaml/page.md":        "# Page\n",
+		"htdocs/index/_index.md":     "---\nauthor: no end\n",
+		"htdocs/index/page.md":       "# Page\n",
+	}, map[string]any{"dir": "htdocs"})
+	for _, tt := range []struct{ path, want string }{
+		{"yaml/page.md", `failed to parse "` + filepath.Join("htdocs", "yaml", "_defaults.yaml") + `"`},
+		{"index/page.md", `failed to parse "` + filepath.Join("htdocs", "index", "_index.md") + `"`},
+	} {
+		_, err := s.readSource(tt.path)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got error %v, want %q", tt.path, err, tt.want)
+		}
+	}
+}
+
+// normalize returns fm with its nested maps as Frontmatter, for comparisons.
+func normalize(fm ktw.Frontmatter) ktw.Frontmatter {
+	out := make(ktw.Frontmatter, len(fm))
+	for k, v := range fm {
+		switch v := v.(type) {
+		case map[string]any:
+			out[k] = normalize(ktw.Frontmatter(v))
+		case ktw.Frontmatter:
+			out[k] = normalize(v)
+		default:
+			out[k] = v
+		}
+	}
+	return out
+}
@@ -1,7 +1,14 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -12,9 +19,203 @@ func init() {
 		Short: "Verify the website",
 		RunE:  verify,
 	}
+	cmd.Flags().Bool("links", false, "also check the links within the generated pages")
+	cmd.Flags().Bool("external", false, "also check the external links (implies --links)")
 	cli.AddCommand(cmd)
 }
 
+// outOfDate returns why the file at dst, generated at dstpath from inputs,
+// is out of date ("Missing" or "Stale (...)"), or the empty string if it is
+// up to date. The hashes of the inputs are compared against those recorded
+// in the manifest, or, for files without an entry, the modification times
+// of the inputs against that of dst.
+func outOfDate(m *manifest, dst, dstpath string, inputs []string, siteHash string) (string, error) {
+	built, err := modTime(dst)
+	if os.IsNotExist(err) {
+		return "Missing", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	entry, err := hashInputs(inputs)
+	if err != nil {
+		return "", err
+	}
+	entry.Site = siteHash
+	if reason, ok := m.changed(dstpath, entry); ok {
+		if reason != "" {
+			return fmt.Sprintf("Stale (%s)", reason), nil
+		}
+		return "", nil
+	}
+
+	for _, input := range inputs {
+		mt, err := modTime(input)
+		if err != nil {
+			return "", err
+		}
+		if mt.After(built) {
+			return fmt.Sprintf("Stale (%s is newer)", input), nil
+		}
+	}
+	return "", nil
+}
+
+// modTime returns the modification time of the file at path.
+func modTime(path string) (time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+// verify traverses the site the same way generate does, and reports every
+// Markdown file whose HTML is missing or out of date with any of its inputs
+// (the Markdown itself, its defaults, its templates and the config file), and
+// every file that is missing or out of date in a separate output directory.
+// The build manifest is used to tell if a file is out of date, if it has an
+// entry for it, and modification times otherwise. HTML files that were
+// generated from a Markdown source that is gone are reported as orphans. It
+// returns an error if anything is out of date, or orphaned. With --links, it
+// also checks that the links within every HTML file point to existing pages,
+// images and anchors, and with --external, that the external links work.
 func verify(cmd *cobra.Command, args []string) error {
-	return errors.New("verify not implemented")
+	if len(args) != 0 {
+		return fmt.Errorf("verify takes no arguments")
+	}
+	s, err := newSite()
+	if err != nil {
+		return err
+	}
+	links, _ := cmd.Flags().GetBool("links")
+	external, _ := cmd.Flags().GetBool("external")
+	return s.verify(cmd.Context(), links, external)
+}
+
+// verify implements the verify command for the site, checking the links if
+// links is set, and the external links too if external is set.
+func (s *site) verify(ctx context.Context, links, external bool) error {
+	root := s.root
+
+	sources, assets, err := s.files()
+	if err != nil {
+		return err
+	}
+	var outputs []string
+	err = filepath.WalkDir(s.output, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".html" {
+			return nil
+		}
+		dstpath, err := filepath.Rel(s.output, path)
+		if err != nil {
+			return err
+		}
+		outputs = append(outputs, dstpath)
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	m, err := loadManifest(manifestFile)
+	if err != nil {
+		return err
+	}
+	var srcs []*source
+	for _, srcpath := range sources {
+		src, err := s.readSource(srcpath)
+		if err != nil {
+			return err
+		}
+		srcs = append(srcs, src)
+	}
+	hashes := hashSite(siteTOC(srcs))
+
+	fmt.Printf("Verifying %s\n", root)
+	stale := 0
+	for _, src := range srcs {
+		dstpath := htmlPath(src.path)
+		reason, err := outOfDate(m, filepath.Join(s.output, dstpath), dstpath, src.inputs, hashes[src.siteUse])
+		if err != nil {
+			return err
+		}
+		if reason != "" {
+			fmt.Printf("%s: %s --> %s\n", reason, src.path, dstpath)
+			stale++
+		}
+	}
+	for _, srcpath := range assets {
+		inputs := []string{filepath.Join(root, srcpath)}
+		reason, err := outOfDate(m, filepath.Join(s.output, srcpath), srcpath, inputs, "")
+		if err != nil {
+			return err
+		}
+		if reason != "" {
+			fmt.Printf("%s: %s\n", reason, srcpath)
+			stale++
+		}
+	}
+
+	known := make(map[string]bool, len(sources)+len(assets))
+	for _, srcpath := range sources {
+		known[htmlPath(srcpath)] = true
+	}
+	for _, srcpath := range assets {
+		known[srcpath] = true
+	}
+	// Only generated files are orphans: other HTML files, such as a
+	// hand-written "404.html", are assets.
+	orphans := 0
+	for _, dstpath := range outputs {
+		if _, generated := m.Outputs[dstpath]; generated && !known[dstpath] {
+			fmt.Printf("Orphan: %s has no Markdown source\n", dstpath)
+			orphans++
+		}
+	}
+
+	broken := 0
+	if links || external {
+		checker := newLinkChecker(s.output)
+		for _, dstpath := range outputs {
+			links, err := checker.check(dstpath)
+			if err != nil {
+				return err
+			}
+			for _, link := range links {
+				fmt.Printf("Broken link: %s\n", link)
+			}
+			broken += len(links)
+		}
+		if external {
+			fmt.Printf("Checking %d external link(s)\n", len(checker.external))
+			links, err := newExternalChecker().check(ctx, checker.external)
+			if err != nil {
+				return err
+			}
+			for _, link := range links {
+				fmt.Printf("Broken link: %s\n", link)
+			}
+			broken += len(links)
+		}
+	}
+
+	var problems []string
+	if stale != 0 {
+		problems = append(problems, fmt.Sprintf("%d generated file(s) out of date, run generate", stale))
+	}
+	if orphans != 0 {
+		problems = append(problems, fmt.Sprintf("%d orphaned file(s)", orphans))
+	}
+	if broken != 0 {
+		problems = append(problems, fmt.Sprintf("%d broken link(s)", broken))
+	}
+	if len(problems) != 0 {
+		return errors.New(strings.Join(problems, ", "))
+	}
+	fmt.Println("Website is up to date!")
+	return nil
 }
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// testSite writes files into a new site directory, makes it the working
+// directory (as main does with --site), and returns the site configured with
+// config.
+func testSite(t *testing.T, files map[string]string, config map[string]any) *site {
+	t.Helper()
+	dir := t.TempDir()
+	writeFiles(t, dir, files)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	for key, value := range config {
+		viper.Set(key, value)
+	}
+	s, err := newSite()
+	if err != nil {
+		t.Fatalf("Got error: %+v", err)
+	}
+	return s
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	s := testSite(t, map[string]string{
+		"htdocs/index.md": "# Home\n",
+		"htdocs/a.md":     "# A\n",
+	}, map[string]any{"dir": "htdocs"})
+	check := func(want string) {
+		t.Helper()
+		got := ""
+		if err := s.verify(ctx, false, false); err != nil {
+			got = err.Error()
+		}
+		if got != want {
+			t.Errorf("Got error %q, want %q", got, want)
+		}
+	}
+	write := func(name, content string, mtime time.Time) {
+		t.Helper()
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(name, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	check("2 generated file(s) out of date, run generate")
+	if _, err := s.build(false, 1); err != nil {
+		t.Fatalf("Got error: %+v", err)
+	}
+	check("")
+
+	// Hand-written HTML files are not orphans, but the generated files whose
+	// source is gone are, even after another build.
+	write("htdocs/404.html", "<p>Not found</p>", time.Now())
+	check("")
+	write("htdocs/b.md", "# B\n", time.Now())
+	if _, err := s.build(false, 1); err != nil {
+		t.Fatalf("Got error: %+v", err)
+	}
+	if err := os.Remove("htdocs/b.md"); err != nil {
+		t.Fatal(err)
+	}
+	check("1 orphaned file(s)")
+	if _, err := s.build(false, 1); err != nil {
+		t.Fatalf("Got error: %+v", err)
+	}
+	check("1 orphaned file(s)")
+	if err := os.Remove("htdocs/b.html"); err != nil {
+		t.Fatal(err)
+	}
+	check("")
+
+	// With a manifest, the contents of the inputs are compared, whatever
+	// their modification times.
+	m, err := loadManifest(manifestFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join("htdocs", "a.md")
+	past := time.Now().Add(-time.Hour)
+	write(src, "# A\n", time.Now().Add(time.Hour))
+	check("")
+	write(src, "# A\n\nChanged.\n", past)
+	check("1 generated file(s) out of date, run generate")
+	reason, err := outOfDate(m, filepath.Join("htdocs", "a.html"), "a.html", []string{src}, "")
+	if want := "Stale (" + src + " changed)"; err != nil || reason != want {
+		t.Errorf("Got %q, %v, want %q", reason, err, want)
+	}
+
+	// Without one, their modification times are compared.
+	if err := os.Remove(manifestFile); err != nil {
+		t.Fatal(err)
+	}
+	check("")
+	write(src, "# A\n\nChanged.\n", time.Now().Add(time.Hour))
+	check("1 generated file(s) out of date, run generate")
+
+	if err := os.Remove(filepath.Join("htdocs", "index.html")); err != nil {
+		t.Fatal(err)
+	}
+	check("2 generated file(s) out of date, run generate")
+}
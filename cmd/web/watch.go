@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+// debounce is how long a watcher waits, after the last change, before
+// reporting the changes.
+const debounce = 100 * time.Millisecond
+
+// watcher watches the files of a site, recursively, and reports the files
+// that changed, in batches.
+type watcher struct {
+	fsw *fsnotify.Watcher
+
+	// triggers reports whether a change to the file (or directory, if dir is
+	// set) at path is reported. Directories it rejects are not watched.
+	triggers func(path string, dir bool) bool
+}
+
+// newWatcher returns a watcher for the files within dirs, and within their
+// subdirectories.
+func newWatcher(triggers func(path string, dir bool) bool, dirs ...string) (*watcher, error) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	w := &watcher{fsw: fsw, triggers: triggers}
+	for _, dir := range dirs {
+		if err := w.add(dir); err != nil {
+			fsw.Close()
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// add watches dir, and its subdirectories.
+func (w *watcher) add(dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path != dir && errors.Is(err, fs.ErrNotExist) {
+				return nil // Removed while walking.
+			}
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != dir && !w.triggers(path, true) {
+			return filepath.SkipDir
+		}
+		return w.fsw.Add(path)
+	})
+}
+
+// run calls changed with the files that changed, once no change has been
+// seen for the debounce delay, until ctx is done. New directories are
+// watched as they are created.
+func (w *watcher) run(ctx context.Context, changed func(paths []string)) error {
+	defer w.fsw.Close()
+	var paths []string
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-w.fsw.Errors:
+			return err
+		case event := <-w.fsw.Events:
+			info, err := os.Stat(event.Name)
+			dir := err == nil && info.IsDir()
+			if !w.triggers(event.Name, dir) {
+				continue
+			}
+			if dir && event.Has(fsnotify.Create) {
+				if err := w.add(event.Name); err != nil {
+					return err
+				}
+			}
+			if !slices.Contains(paths, event.Name) {
+				paths = append(paths, event.Name)
+			}
+			timer.Reset(debounce)
+		case <-timer.C:
+			changed(paths)
+			paths = nil
+		}
+	}
+}
+
+// watchDirs returns the directories to watch for changes to the site: the
+// site directory itself (holding the config and ignore files), the site's
+// root, and the directories of its templates.
+func (s *site) watchDirs() []string {
+	dirs := []string{"."}
+	for _, path := range append([]string{s.root}, s.tmplPaths...) {
+		dir := path
+		if path != s.root {
+			dir = filepath.Dir(path)
+		}
+		if !within(".", dir) && !slices.Contains(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// triggers reports whether a change to the file (or directory, if dir is
+// set) at path, relative to the site directory, may change the generated
+// site. Generated files, hidden files (such as those of the '.web'
+// directory, or of editors) and ignored files do not.
+func (s *site) triggers(path string, dir bool) bool {
+	path = filepath.Clean(path)
+	if s.separate() && within(s.output, path) {
+		return false
+	}
+	name := filepath.Base(path)
+	if path != "." && strings.HasPrefix(name, ".") && name != ignoreFile {
+		return false
+	}
+	if slices.ContainsFunc(s.tmplPaths, func(tmpl string) bool { return sameFile(tmpl, path) }) {
+		return true
+	}
+	if cfg := viper.ConfigFileUsed(); cfg != "" && sameFile(cfg, path) {
+		return true
+	}
+	if within(s.root, path) {
+		relpath, err := filepath.Rel(s.root, path)
+		if err != nil || (relpath != "." && ignored(s.ignore, relpath, dir)) {
+			return false
+		}
+	}
+	if !s.separate() && filepath.Ext(path) == ".html" {
+		// Generated alongside its Markdown source.
+		if _, err := os.Stat(strings.TrimSuffix(path, ".html") + ".md"); err == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// within reports whether path is dir, or is within dir.
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(absPath(dir), absPath(path))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// sameFile reports whether the paths a and b refer to the same file.
+func sameFile(a, b string) bool {
+	return absPath(a) == absPath(b)
+}
+
+// absPath returns the absolute form of path, or path itself if it has none.
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestSiteTriggers(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"htdocs/index.md":   "# Home",
+		"htdocs/index.html": "<p>Home</p>",
+		"htdocs/hand.html":  "<p>Hand</p>",
+	})
+	root := filepath.Join(dir, "htdocs")
+	tmpl := filepath.Join(root, "article.tmpl")
+	s := &site{root: root, output: root, ignore: defaultIgnore, tmplPaths: []string{tmpl}}
+
+	tests := []struct {
+		path string
+		dir  bool
+		want bool
+	}{
+		{"htdocs/index.md", false, true},
+		{"htdocs/hand.html", false, true},
+		{"htdocs/index.html", false, false},
+		{"htdocs/article.tmpl", false, true},
+		{"htdocs/other.tmpl", false, false},
+		{"htdocs/.index.md.swp", false, false},
+		{"htdocs/_drafts", true, false},
+		{".web", true, false},
+		{".webignore", false, true},
+	}
+	for _, tt := range tests {
+		if got := s.triggers(filepath.Join(dir, tt.path), tt.dir); got != tt.want {
+			t.Errorf("triggers(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+
+	s.output = filepath.Join(root, "public")
+	if s.triggers(filepath.Join(s.output, "index.html"), false) {
+		t.Errorf("triggers() = true for a file in the output directory")
+	}
+	if !s.triggers(filepath.Join(root, "index.html"), false) {
+		t.Errorf("triggers() = false for a hand-written file with a separate output")
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.md": "a", "skip/b.md": "b"})
+	triggers := func(path string, _ bool) bool { return filepath.Base(path) != "skip" }
+	w, err := newWatcher(triggers, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := make(chan []string)
+	go w.run(ctx, func(paths []string) { changes <- paths })
+
+	write := func(name string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("changed"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Changes in a burst are reported together.
+	write("a.md")
+	write("skip/b.md")
+	if err := os.Mkdir(filepath.Join(dir, "new"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-changes:
+		sort.Strings(got)
+		if want := []string{filepath.Join(dir, "a.md"), filepath.Join(dir, "new")}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Got changes %q, want %q", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("No changes reported")
+	}
+
+	// New directories are watched.
+	write("new/c.md")
+	select {
+	case got := <-changes:
+		if want := []string{filepath.Join(dir, "new", "c.md")}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Got changes %q, want %q", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("No changes reported")
+	}
+}
@@ -0,0 +1,52 @@
+package ktw
+
+import (
+	"fmt"
+	"strings"
+
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+// ChromaCSS returns the CSS stylesheet for the classes used by highlighted
+// code blocks, in the named Chroma style (such as "github").
+func ChromaCSS(style string) (string, error) {
+	s, ok := styles.Registry[strings.ToLower(style)]
+	if !ok {
+		return "", fmt.Errorf("unknown Chroma style %q", style)
+	}
+	var buf strings.Builder
+	formatter := chromahtml.New(
+		chromahtml.WithClasses(true),
+		chromahtml.WithLineNumbers(true),
+	)
+	if err := formatter.WriteCSS(&buf, s); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// ChromaColorSchemeCSS returns a CSS stylesheet like ChromaCSS, using the
+// light style by default, and the dark style when the reader prefers a dark
+// color scheme.
+func ChromaColorSchemeCSS(light, dark string) (string, error) {
+	lightCSS, err := ChromaCSS(light)
+	if err != nil {
+		return "", err
+	}
+	darkCSS, err := ChromaCSS(dark)
+	if err != nil {
+		return "", err
+	}
+
+	var buf strings.Builder
+	buf.WriteString(lightCSS)
+	buf.WriteString("@media (prefers-color-scheme: dark) {\n")
+	for _, line := range strings.SplitAfter(darkCSS, "\n") {
+		if line != "" {
+			buf.WriteString("  " + line)
+		}
+	}
+	buf.WriteString("}\n")
+	return buf.String(), nil
+}
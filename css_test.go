@@ -0,0 +1,39 @@
+package ktw
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChromaCSS(t *testing.T) {
+	css, err := ChromaCSS("github")
+	if err != nil {
+		t.Fatalf("Got error: %+v", err)
+	}
+	for _, want := range []string{".chroma {", ".chroma .hl {", ".chroma .ln {", ".chroma .kd {"} {
+		if !strings.Contains(css, want) {
+			t.Errorf("CSS does not contain %q:\n%s", want, css)
+		}
+	}
+
+	if _, err := ChromaCSS("no-such-style"); err == nil {
+		t.Errorf("ChromaCSS(%q) returned no error", "no-such-style")
+	}
+}
+
+func TestChromaColorSchemeCSS(t *testing.T) {
+	css, err := ChromaColorSchemeCSS("github", "monokai")
+	if err != nil {
+		t.Fatalf("Got error: %+v", err)
+	}
+	light, dark, ok := strings.Cut(css, "@media (prefers-color-scheme: dark) {\n")
+	if !ok {
+		t.Fatalf("CSS has no dark color scheme:\n%s", css)
+	}
+	if want, _ := ChromaCSS("github"); light != want {
+		t.Errorf("Light CSS = %q, want %q", light, want)
+	}
+	if !strings.HasPrefix(dark, "  /* Background */ .bg {") || !strings.HasSuffix(dark, "}\n}\n") {
+		t.Errorf("Dark CSS is not nested within the media query:\n%s", dark)
+	}
+}
@@ -0,0 +1,258 @@
+package ktw
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/util"
+)
+
+// A diff code block holds the "before" and "after" versions of a snippet,
+// separated by a line holding only ":::", such as:
+//
+//	```go {.diff}
+//	fmt.Println("Hello")
+//	:::
+//	fmt.Println("Hello World!")
+//	```
+//
+// It is rendered as a single highlighted block, showing the line-level diff
+// of the two versions. Adding the "side-by-side" class shows the versions
+// next to each other, rather than as a unified diff.
+const diffSeparator = ":::"
+
+// diffOp is the operation of a line in a diff.
+type diffOp int
+
+const (
+	diffEqual diffOp = iota
+	diffDelete
+	diffInsert
+)
+
+// diffLine is a line in a diff, with its index in the before and/or after
+// lines.
+type diffLine struct {
+	op            diffOp
+	before, after int
+}
+
+// diffLines returns the line-level diff of before and after, based on their
+// longest common subsequence.
+func diffLines(before, after []string) []diffLine {
+	// lcs[i][j] is the length of the LCS of before[i:] and after[j:].
+	lcs := make([][]int, len(before)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(after)+1)
+	}
+	for i := len(before) - 1; i >= 0; i-- {
+		for j := len(after) - 1; j >= 0; j-- {
+			if before[i] == after[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var diff []diffLine
+	i, j := 0, 0
+	for i < len(before) && j < len(after) {
+		switch {
+		case before[i] == after[j]:
+			diff = append(diff, diffLine{diffEqual, i, j})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, diffLine{diffDelete, i, -1})
+			i++
+		default:
+			diff = append(diff, diffLine{diffInsert, -1, j})
+			j++
+		}
+	}
+	for ; i < len(before); i++ {
+		diff = append(diff, diffLine{diffDelete, i, -1})
+	}
+	for ; j < len(after); j++ {
+		diff = append(diff, diffLine{diffInsert, -1, j})
+	}
+	return diff
+}
+
+// splitDiff splits the lines of a diff code block into the before and after
+// versions. It returns false if there is no separator.
+func splitDiff(n *ast.FencedCodeBlock, source []byte) (string, string, bool) {
+	var before, after strings.Builder
+	found := false
+	for i := 0; i < n.Lines().Len(); i++ {
+		line := n.Lines().At(i)
+		value := line.Value(source)
+		switch {
+		case !found && string(bytes.TrimSpace(value)) == diffSeparator:
+			found = true
+		case found:
+			after.Write(value)
+		default:
+			before.Write(value)
+		}
+	}
+	return before.String(), after.String(), found
+}
+
+// highlightLines tokenises code and returns its highlighted HTML, one entry
+// per line, without the trailing newlines. It also returns the text of each
+// line, to compute the diff with.
+func (r *codeBlockRenderer) highlightLines(lexer chroma.Lexer, code string) ([]string, []string, error) {
+	iterator, err := lexer.Tokenise(nil, code)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Clipped, so that concurrent renders never append into the shared array.
+	formatter := chromahtml.New(append(slices.Clip(r.formatOptions),
+		chromahtml.WithLineNumbers(false),
+		chromahtml.PreventSurroundingPre(true),
+	)...)
+
+	var html, lines []string
+	for _, tokens := range chroma.SplitTokensIntoLines(iterator.Tokens()) {
+		var line strings.Builder
+		for i, token := range tokens {
+			if i == len(tokens)-1 {
+				token.Value = strings.TrimSuffix(token.Value, "\n")
+				tokens[i] = token
+			}
+			line.WriteString(token.Value)
+		}
+		var buf bytes.Buffer
+		if err := formatter.Format(&buf, styles.Fallback, chroma.Literator(tokens...)); err != nil {
+			return nil, nil, err
+		}
+		html = append(html, buf.String())
+		lines = append(lines, line.String())
+	}
+	return html, lines, nil
+}
+
+// renderDiff renders a diff code block. It returns false if the code block
+// is not a valid diff, and should be rendered as an ordinary code block.
+func (r *codeBlockRenderer) renderDiff(w util.BufWriter, source []byte, n *ast.FencedCodeBlock, attrs parser.Attributes) bool {
+	before, after, ok := splitDiff(n, source)
+	if !ok {
+		return false
+	}
+
+	language := n.Language(source)
+	var lexer chroma.Lexer
+	if language != nil {
+		lexer = lexers.Get(string(language))
+	}
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	lexer = chroma.Coalesce(lexer)
+
+	beforeHTML, beforeLines, err := r.highlightLines(lexer, before)
+	if err != nil {
+		return false
+	}
+	afterHTML, afterLines, err := r.highlightLines(lexer, after)
+	if err != nil {
+		return false
+	}
+	diff := diffLines(beforeLines, afterLines)
+
+	if hasClass(attrs, "side-by-side") {
+		renderSideBySide(w, language, (&codeBlockContext{attrs: attrs}).All(), diff, beforeHTML, afterHTML)
+		return true
+	}
+
+	codeWrapper(w, &codeBlockContext{language: language, attrs: attrs}, true)
+	for _, line := range diff {
+		switch line.op {
+		case diffEqual:
+			writeDiffLine(w, "ctx", " ", "", afterHTML[line.after])
+		case diffDelete:
+			writeDiffLine(w, "del", "-", "del", beforeHTML[line.before])
+		case diffInsert:
+			writeDiffLine(w, "ins", "+", "ins", afterHTML[line.after])
+		}
+		w.WriteString("\n")
+	}
+	codeWrapper(w, &codeBlockContext{language: language, attrs: attrs}, false)
+	return true
+}
+
+// renderSideBySide renders a diff as a table, with the before version on the
+// left and the after version on the right. Deleted and inserted lines
+// between the same unchanged lines are shown next to each other.
+func renderSideBySide(w util.BufWriter, language []byte, attrs []ast.Attribute, diff []diffLine, beforeHTML, afterHTML []string) {
+	w.WriteString(`<table`)
+	writeCodeAttributes(w, language, "chroma", attrs)
+	w.WriteString(">\n<tbody>\n")
+
+	var deleted, inserted []string
+	flush := func() {
+		for i := 0; i < max(len(deleted), len(inserted)); i++ {
+			w.WriteString("<tr>")
+			if i < len(deleted) {
+				writeDiffCell(w, "del", "-", "del", deleted[i])
+			} else {
+				w.WriteString(`<td class="line empty"></td>`)
+			}
+			if i < len(inserted) {
+				writeDiffCell(w, "ins", "+", "ins", inserted[i])
+			} else {
+				w.WriteString(`<td class="line empty"></td>`)
+			}
+			w.WriteString("</tr>\n")
+		}
+		deleted, inserted = nil, nil
+	}
+	for _, line := range diff {
+		switch line.op {
+		case diffEqual:
+			flush()
+			w.WriteString("<tr>")
+			writeDiffCell(w, "ctx", " ", "", beforeHTML[line.before])
+			writeDiffCell(w, "ctx", " ", "", afterHTML[line.after])
+			w.WriteString("</tr>\n")
+		case diffDelete:
+			deleted = append(deleted, beforeHTML[line.before])
+		case diffInsert:
+			inserted = append(inserted, afterHTML[line.after])
+		}
+	}
+	flush()
+	w.WriteString("</tbody>\n</table>\n")
+}
+
+// writeDiffLine writes a line of a unified diff, marked with class and
+// marker, and with its highlighted HTML wrapped in the tag element (if any).
+func writeDiffLine(w util.BufWriter, class, marker, tag, html string) {
+	w.WriteString(`<span class="line ` + class + `"><span class="ln">` + marker + `</span><span class="cl">`)
+	writeTagged(w, tag, html)
+	w.WriteString(`</span></span>`)
+}
+
+// writeDiffCell writes a cell of a side-by-side diff, like writeDiffLine.
+func writeDiffCell(w util.BufWriter, class, marker, tag, html string) {
+	w.WriteString(`<td class="line ` + class + `"><span class="ln">` + marker + `</span><span class="cl">`)
+	writeTagged(w, tag, html)
+	w.WriteString(`</span></td>`)
+}
+
+func writeTagged(w util.BufWriter, tag, html string) {
+	if tag == "" {
+		w.WriteString(html)
+		return
+	}
+	w.WriteString("<" + tag + ">" + html + "</" + tag + ">")
+}
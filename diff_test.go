@@ -0,0 +1,77 @@
+package ktw
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	before := []string{"a", "b", "c", "d"}
+	after := []string{"a", "c", "x", "d", "e"}
+	want := []diffLine{
+		{diffEqual, 0, 0},
+		{diffDelete, 1, -1},
+		{diffEqual, 2, 1},
+		{diffInsert, -1, 2},
+		{diffEqual, 3, 3},
+		{diffInsert, -1, 4},
+	}
+	if got := diffLines(before, after); !reflect.DeepEqual(got, want) {
+		t.Errorf("diffLines() = %v, want %v", got, want)
+	}
+}
+
+func TestDiffCodeBlock(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		doc  string
+		want []string
+	}{
+		{
+			name: "unified",
+			doc:  "'''go {.diff #example}\nx := 1\ny := 2\n:::\nx := 1\nz := 3\n'''",
+			want: []string{
+				`<pre class="chroma"><code class="language-go diff" id="example">`,
+				`<span class="line ctx"><span class="ln"> </span><span class="cl"><span class="nx">x</span>`,
+				`<span class="line del"><span class="ln">-</span><span class="cl"><del><span class="nx">y</span>`,
+				`<span class="line ins"><span class="ln">+</span><span class="cl"><ins><span class="nx">z</span>`,
+				`</code></pre>`,
+			},
+		},
+		{
+			name: "side by side",
+			doc:  "'''go {.diff .side-by-side}\nx := 1\ny := 2\n:::\nx := 1\n'''",
+			want: []string{
+				`<table class="chroma language-go diff side-by-side">`,
+				`<tr><td class="line ctx"><span class="ln"> </span><span class="cl"><span class="nx">x</span>`,
+				`<tr><td class="line del"><span class="ln">-</span><span class="cl"><del><span class="nx">y</span>`,
+				`<td class="line empty"></td></tr>`,
+			},
+		},
+		{
+			name: "no separator",
+			doc:  "'''go {.diff}\nx := 1\n'''",
+			want: []string{
+				`<pre class="chroma"><code class="language-go diff">`,
+				`<span class="line"><span class="ln">1</span><span class="cl"><span class="nx">x</span>`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := md(tt.doc).Render(ctx, &buf); err != nil {
+				t.Fatalf("Got error: %+v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("Output does not contain %q:\n%s", want, buf.String())
+				}
+			}
+		})
+	}
+}
@@ -3,10 +3,26 @@ Package ktw implements fuctionality to write Web applications in a Go centric
 manner. It implements a simple Markdown converter with extra functionality.
 
 It uses a customized Goldmark Markdown processor that contains a few enhancements.
-In particular, it allows for special styling of "Note:", "Info:", and "Warning:"
-paragraphs, which are paragraphs that start with the aforementioned words (with
-the following ":"). These will be rendered as HTML "<p>" elements with a class of
-"note", "info", and "warning" respectively.
+In particular, it allows for special styling of callouts, such as "Note:", "Info:",
+and "Warning:" paragraphs, which are paragraphs that start with the aforementioned
+words (with the following ":"). These will be rendered as HTML "<p>" elements with
+a class of "note", "info", and "warning" respectively. The recognised callouts, and
+their classes, can be configured with WithCallouts (see DefaultCallouts).
+
+The same callouts can be written as GitHub-style alerts, which can also hold
+multiple paragraphs, lists and code blocks:
+
+	> [!NOTE]
+	> This is a note.
+
+These are rendered as an HTML "<div>" element with a class of "note". The GitHub
+alert types NOTE, TIP, IMPORTANT, WARNING and CAUTION are styled as the "Note:",
+"Tip:", "Info:", "Warning:" and "Danger:" callouts respectively.
+
+By default, the label of a callout ("Note:") is kept as part of its text. The
+Label of a Callout can instead wrap it in a <strong class="callout-label">
+element (LabelWrap), or drop it altogether (LabelDrop). An alert shows its
+label, such as "Note", as its first paragraph, unless it is dropped.
 
 The code fence has also been enhanced. It uses the Chroma extension to parse and
 provide spans with classes (as before), but it adds the ability to add attributes
@@ -29,5 +45,47 @@ Would result in a code element such as: <code class="language-go bad" id="exampl
 These can be used to provide different styles for different languages, as well as
 different styles (for example, background color) for code blocks. The IDs can be used
 to select (or point to) specific code blocks in the rendered HTML.
+
+Line numbers, and highlighted lines, can be set for each code block:
+
+```go {hl_lines="3-5,9" linenostart=42 linenos=false}
+package awesome
+```
+
+Where "hl_lines" lists the lines (counted from the first line of the code block) to
+highlight, "linenostart" sets the number of the first line, and "linenos" turns line
+numbers on or off.
+
+A code block with the "diff" class holds a "before" and "after" version of a snippet,
+separated by a line holding only ":::":
+
+```go {.diff}
+fmt.Println("Hello")
+:::
+fmt.Println("Hello World!")
+```
+
+It is rendered as a single highlighted block, with each line marked with a class of
+"del" (and wrapped in a "<del>" element), "ins" (wrapped in an "<ins>" element) or
+"ctx" for unchanged lines. Adding the "side-by-side" class renders the two versions
+next to each other, in a "<table>".
+
+A paragraph holding only "{{toc}}" marks where the table of contents of the page
+goes. When rendering a Page, it is replaced by the TOC of the page, built from the
+headings of its Markdown contents (see ExtractTOC). Templates can use the TOC of
+the page as ".TOC", and the SiteTOC of the whole site as ".Site" or "{{sitetoc}}".
+
+Headings are given an id generated from their text, unless one is given explicitly,
+as in "## Usage {#usage}". The ids are kept unique across all the Markdown contents
+of a Page by a shared HeadingIDs registry, and duplicate explicit ids are reported
+in the Warnings of the Page. A heading can keep its old ids working as anchors by
+listing them in an "aliases" attribute, as in "## Usage {#usage aliases="use,how"}".
+With WithHeadingAnchors, each heading is given a link to itself, such as
+<a class="anchor" href="#usage">#</a>, so readers can copy a link to a section.
+
+With WithLinkRewriting, relative links to Markdown files, such as
+"../article-02/index.md#usage", are rewritten to link to the HTML files generated
+from them, and links to missing files are reported as errors. The links are
+resolved against the path of the page, as set with ContextWithPagePath.
 */
 package ktw
@@ -0,0 +1,152 @@
+package ktw
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/yuin/goldmark/ast"
+	"gopkg.in/yaml.v3"
+)
+
+// Document is a parsed Markdown document: its frontmatter, the Markdown body
+// that follows the frontmatter, and the Goldmark AST of that body.
+//
+// A Document is a Renderer, so a Page can be built from it directly:
+//
+//	doc, err := ktw.ParseDocument(buf)
+//	...
+//	page := &ktw.Page{
+//		Metadata: doc.Frontmatter,
+//		Contents: []ktw.Renderer{doc},
+//	}
+type Document struct {
+	Frontmatter Frontmatter
+	Body        Markdown
+	AST         ast.Node
+
+	engine *MarkdownEngine
+	ids    *HeadingIDs // the ids of the headings of AST were registered in
+}
+
+// ParseDocument splits buf into its frontmatter and Markdown body, and parses
+// both using the default MarkdownEngine. See SplitFrontmatter for the
+// supported frontmatter formats.
+func ParseDocument(buf []byte) (*Document, error) {
+	return DefaultMarkdownEngine().ParseDocument(buf)
+}
+
+// Render the parsed Markdown body into HTML.
+//
+// The ids of the headings are assigned when the document is parsed. If ctx
+// carries other HeadingIDs than the document was parsed with (see
+// ParseDocumentContext), as when a Page built from ParseDocument results is
+// rendered, the body is parsed again so that its ids are unique across the
+// page.
+//
+// A Document built by hand, rather than parsed, is rendered with the default
+// MarkdownEngine, and its Body is parsed if it has no AST.
+func (d *Document) Render(ctx context.Context, w io.Writer) error {
+	engine := d.engine
+	if engine == nil {
+		engine = DefaultMarkdownEngine()
+	}
+	doc := d.AST
+	if ids := HeadingIDsFromContext(ctx); doc == nil || (ids != nil && ids != d.ids) {
+		var err error
+		if doc, err = engine.parse(ctx, d.Body); err != nil {
+			return err
+		}
+	}
+	addTOC(ctx, ExtractTOC(doc, d.Body))
+	return engine.md.Renderer().Render(w, d.Body, doc)
+}
+
+// Frontmatter formats recognised by splitContent.
+const (
+	formatNone = ""
+	formatYAML = "yaml"
+	formatTOML = "toml"
+	formatJSON = "json"
+)
+
+// SplitFrontmatter splits buf into its parsed frontmatter and the Markdown
+// body that follows it. YAML frontmatter is delimited by "---" lines, TOML
+// frontmatter by "+++" lines, and JSON frontmatter is a single object at the
+// start of buf. Without frontmatter, all of buf is the body and the returned
+// Frontmatter is empty.
+func SplitFrontmatter(buf []byte) (Frontmatter, Markdown, error) {
+	format, meta, content, err := splitContent(buf)
+	if err != nil {
+		return nil, nil, err
+	}
+	fm, err := parseFrontmatter(format, meta)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse %s frontmatter: %w", format, err)
+	}
+	return fm, Markdown(content), nil
+}
+
+// splitContent splits the full contents of a file into the format of its
+// frontmatter, the metadata, and the rest of the content. A file without
+// frontmatter, including one starting with a "{" that is not a JSON object
+// (such as the "{{toc}}" placeholder), is returned as content with
+// formatNone. It returns an error if the closing delimiter is not found.
+func splitContent(buf []byte) (string, []byte, []byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	var meta json.RawMessage
+	if bytes.HasPrefix(buf, []byte("{")) && dec.Decode(&meta) == nil && bytes.HasPrefix(meta, []byte("{")) {
+		content := buf[dec.InputOffset():]
+		// Drop the remainder of the line the object ends on.
+		if _, rest, ok := bytes.Cut(content, []byte("\n")); ok {
+			content = rest
+		}
+		return formatJSON, meta, content, nil
+	}
+
+	first, rest, _ := bytes.Cut(buf, []byte("\n"))
+	var format string
+	switch string(bytes.TrimSpace(first)) {
+	case "---":
+		format = formatYAML
+	case "+++":
+		format = formatTOML
+	default:
+		return formatNone, nil, buf, nil
+	}
+	delim := bytes.TrimSpace(first)
+
+	for pos := 0; pos < len(rest); {
+		line, _, _ := bytes.Cut(rest[pos:], []byte("\n"))
+		next := pos + len(line) + 1
+		if bytes.Equal(bytes.TrimSpace(line), delim) {
+			return format, rest[:pos], rest[min(next, len(rest)):], nil
+		}
+		pos = next
+	}
+	return "", nil, nil, fmt.Errorf("closing %q delimiter not found", delim)
+}
+
+// parseFrontmatter parses meta, in the given format, into a Frontmatter.
+func parseFrontmatter(format string, meta []byte) (Frontmatter, error) {
+	fm := make(Frontmatter)
+	var err error
+	switch format {
+	case formatYAML:
+		err = yaml.Unmarshal(meta, &fm)
+	case formatTOML:
+		err = toml.Unmarshal(meta, &fm)
+	case formatJSON:
+		err = json.Unmarshal(meta, &fm)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fm, nil
+}
+
+// Interface guard.
+var _ Renderer = (*Document)(nil)
@@ -0,0 +1,98 @@
+package ktw
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+func TestSplitFrontmatter(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		title string
+		body  string
+	}{
+		{"yaml", "---\ntitle: YAML\n---\n# Body\n", "YAML", "# Body\n"},
+		{"toml", "+++\ntitle = \"TOML\"\n+++\n# Body\n", "TOML", "# Body\n"},
+		{"json", "{\"title\": \"JSON\"}\n# Body\n", "JSON", "# Body\n"},
+		{"none", "# Body\n", "", "# Body\n"},
+		{"toc placeholder", "{{toc}}\n\n# Body\n", "", "{{toc}}\n\n# Body\n"},
+		{"invalid json", "{\"title\": \"no end\"\n# Body\n", "", "{\"title\": \"no end\"\n# Body\n"},
+		{"empty", "---\n---\n# Body\n", "", "# Body\n"},
+		{"no body", "---\ntitle: YAML\n---", "YAML", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fm, body, err := SplitFrontmatter([]byte(tt.doc))
+			if err != nil {
+				t.Fatalf("Got error: %+v", err)
+			}
+			if got := fm.Title(); got != tt.title {
+				t.Errorf("Title() = %q, want %q", got, tt.title)
+			}
+			if got := string(body); got != tt.body {
+				t.Errorf("body = %q, want %q", got, tt.body)
+			}
+		})
+	}
+}
+
+func TestSplitFrontmatterErrors(t *testing.T) {
+	for _, doc := range []string{
+		"---\ntitle: no end\n# Body\n",
+		"+++\ntitle = \"no end\"\n",
+		"---\ntitle: [bad\n---\n",
+	} {
+		if _, _, err := SplitFrontmatter([]byte(doc)); err == nil {
+			t.Errorf("SplitFrontmatter(%q) returned no error", doc)
+		}
+	}
+}
+
+func TestParseDocument(t *testing.T) {
+	ctx := context.Background()
+	doc, err := ParseDocument([]byte("---\ntitle: Doc\n---\n# Heading\n\nText.\n"))
+	if err != nil {
+		t.Fatalf("Got error: %+v", err)
+	}
+	if got := doc.Frontmatter.Title(); got != "Doc" {
+		t.Errorf("Title() = %q, want %q", got, "Doc")
+	}
+	if kind := doc.AST.FirstChild().Kind(); kind != ast.KindHeading {
+		t.Errorf("first node is %v, want %v", kind, ast.KindHeading)
+	}
+
+	var buf bytes.Buffer
+	if err := doc.Render(ctx, &buf); err != nil {
+		t.Fatalf("Got error: %+v", err)
+	}
+	want := "<h1 id=\"heading\">Heading</h1>\n<p>Text.</p>\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Got %q, want %q", got, want)
+	}
+}
+
+func TestDocumentByHand(t *testing.T) {
+	ctx := context.Background()
+	body := Markdown("# Heading\n\nText.\n")
+	parsed, err := ParseDocument(body)
+	if err != nil {
+		t.Fatalf("Got error: %+v", err)
+	}
+	want := "<h1 id=\"heading\">Heading</h1>\n<p>Text.</p>\n"
+	for _, doc := range []*Document{
+		{Body: body, AST: parsed.AST},
+		{Body: body},
+	} {
+		var buf bytes.Buffer
+		if err := doc.Render(ctx, &buf); err != nil {
+			t.Fatalf("Got error: %+v", err)
+		}
+		if got := buf.String(); got != want {
+			t.Errorf("Got %q, want %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package ktw
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"sync"
+
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	d2 "github.com/nuttyswiss/goldmark-d2"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	gmhtml "github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// MarkdownEngine is a Markdown processor, built once with the customized
+// Goldmark extensions of this package. It is safe for concurrent use by
+// multiple goroutines.
+type MarkdownEngine struct {
+	md goldmark.Markdown
+}
+
+// EngineOption configures a MarkdownEngine.
+type EngineOption func(*engineConfig)
+
+type engineConfig struct {
+	d2          bool
+	typographer bool
+	unsafe      bool
+	callouts    map[string]Callout
+	anchors     goldmark.Extender
+	links       goldmark.Extender
+	chroma      []chromahtml.Option
+	extensions  []goldmark.Extender
+	parsers     []util.PrioritizedValue
+}
+
+// WithD2 enables or disables the rendering of D2 diagrams. Enabled by default.
+func WithD2(enable bool) EngineOption {
+	return func(c *engineConfig) { c.d2 = enable }
+}
+
+// WithTypographer enables or disables the replacement of punctuation with
+// typographic entities. Enabled by default.
+func WithTypographer(enable bool) EngineOption {
+	return func(c *engineConfig) { c.typographer = enable }
+}
+
+// WithUnsafeHTML enables or disables the rendering of raw HTML and
+// potentially dangerous links. Enabled by default.
+func WithUnsafeHTML(enable bool) EngineOption {
+	return func(c *engineConfig) { c.unsafe = enable }
+}
+
+// WithLineNumbers enables or disables line numbers in code blocks. Enabled
+// by default.
+func WithLineNumbers(enable bool) EngineOption {
+	return func(c *engineConfig) {
+		c.chroma = append(c.chroma, chromahtml.WithLineNumbers(enable))
+	}
+}
+
+// WithTabWidth sets the width of a tab in code blocks. Defaults to 4.
+func WithTabWidth(width int) EngineOption {
+	return func(c *engineConfig) {
+		c.chroma = append(c.chroma, chromahtml.TabWidth(width))
+	}
+}
+
+// WithCallouts sets the callouts that are recognised, by their prefix, both
+// as paragraphs and as GitHub-style alerts. Defaults to DefaultCallouts.
+func WithCallouts(callouts map[string]Callout) EngineOption {
+	return func(c *engineConfig) { c.callouts = callouts }
+}
+
+// WithHeadingAnchors appends a `<a class="anchor">` link to itself to each
+// heading, at the given levels (or all levels, if none are given). See
+// NewHeadingAnchors. Disabled by default.
+func WithHeadingAnchors(symbol string, levels ...int) EngineOption {
+	return func(c *engineConfig) { c.anchors = NewHeadingAnchors(symbol, levels...) }
+}
+
+// WithLinkRewriting rewrites relative links to Markdown files into links to
+// the HTML files generated from them, checking that the files exist in fsys.
+// See NewLinkRewriter. Disabled by default.
+func WithLinkRewriting(fsys fs.FS, pretty bool) EngineOption {
+	return func(c *engineConfig) { c.links = NewLinkRewriter(fsys, pretty) }
+}
+
+// WithExtensions adds extra Goldmark extensions.
+func WithExtensions(ext ...goldmark.Extender) EngineOption {
+	return func(c *engineConfig) { c.extensions = append(c.extensions, ext...) }
+}
+
+// WithBlockParsers adds extra block parsers, along with their priority.
+func WithBlockParsers(parsers ...util.PrioritizedValue) EngineOption {
+	return func(c *engineConfig) { c.parsers = append(c.parsers, parsers...) }
+}
+
+// NewMarkdownEngine returns a MarkdownEngine configured with opts.
+func NewMarkdownEngine(opts ...EngineOption) *MarkdownEngine {
+	c := &engineConfig{
+		d2:          true,
+		typographer: true,
+		unsafe:      true,
+		callouts:    DefaultCallouts,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	extensions := []goldmark.Extender{
+		extension.GFM,
+		extension.Footnote,
+		extension.Strikethrough,
+		extension.Table,
+		extension.TaskList,
+	}
+	if c.typographer {
+		extensions = append(extensions, extension.Typographer)
+	}
+	if c.d2 {
+		extensions = append(extensions, &d2.Extender{
+			// Layout:  d2elklayout.Layout,
+			// ThemeID: &d2themescatalog.Terminal.ID,
+		})
+	}
+	if len(c.callouts) != 0 {
+		extensions = append(extensions, NewCallouts(c.callouts), NewAlerts(c.callouts))
+	}
+	extensions = append(extensions, NewCustomCodeHighlight(c.chroma...), NewTOCPlaceholder(), NewHeadingAliases())
+	if c.anchors != nil {
+		extensions = append(extensions, c.anchors)
+	}
+	if c.links != nil {
+		extensions = append(extensions, c.links)
+	}
+	extensions = append(extensions, c.extensions...)
+
+	var rendererOpts []goldmark.Option
+	if c.unsafe {
+		rendererOpts = append(rendererOpts, goldmark.WithRendererOptions(gmhtml.WithUnsafe()))
+	}
+
+	return &MarkdownEngine{
+		md: goldmark.New(append([]goldmark.Option{
+			goldmark.WithExtensions(extensions...),
+			goldmark.WithParserOptions(
+				parser.WithAttribute(),
+				parser.WithAutoHeadingID(),
+				parser.WithBlockParsers(c.parsers...),
+			),
+		}, rendererOpts...)...),
+	}
+}
+
+// DefaultMarkdownEngine returns the MarkdownEngine with the default options,
+// as used by Markdown.Render and ParseDocument.
+func DefaultMarkdownEngine() *MarkdownEngine {
+	return defaultMarkdownEngine()
+}
+
+var defaultMarkdownEngine = sync.OnceValue(func() *MarkdownEngine {
+	return NewMarkdownEngine()
+})
+
+// Render Markdown into HTML. If ctx carries HeadingIDs (see
+// ContextWithHeadingIDs), the ids of the headings are registered within it.
+// If ctx carries the path of the page (see ContextWithPagePath), relative
+// links are resolved against it.
+func (e *MarkdownEngine) Render(ctx context.Context, m Markdown, w io.Writer) error {
+	doc, err := e.parse(ctx, m)
+	if err != nil {
+		return err
+	}
+	addTOC(ctx, ExtractTOC(doc, m))
+	return e.md.Renderer().Render(w, m, doc)
+}
+
+// ParseDocument splits buf into its frontmatter and Markdown body, and parses
+// both. See SplitFrontmatter for the supported frontmatter formats.
+func (e *MarkdownEngine) ParseDocument(buf []byte) (*Document, error) {
+	return e.ParseDocumentContext(context.Background(), buf)
+}
+
+// ParseDocumentContext is like ParseDocument, but registers the ids of the
+// headings within the HeadingIDs carried by ctx, if any, and resolves
+// relative links against the path of the page carried by ctx, if any. The
+// same ctx should be used to render the Page the Document is part of.
+func (e *MarkdownEngine) ParseDocumentContext(ctx context.Context, buf []byte) (*Document, error) {
+	fm, body, err := SplitFrontmatter(buf)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := e.parse(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+	return &Document{
+		Frontmatter: fm,
+		Body:        body,
+		AST:         doc,
+		engine:      e,
+		ids:         HeadingIDsFromContext(ctx),
+	}, nil
+}
+
+// parse parses source, using the HeadingIDs and page path carried by ctx, if
+// any. It returns the errors found while parsing, such as broken links.
+func (e *MarkdownEngine) parse(ctx context.Context, source []byte) (ast.Node, error) {
+	var opts []parser.ContextOption
+	if ids := HeadingIDsFromContext(ctx); ids != nil {
+		opts = append(opts, parser.WithIDs(ids))
+	}
+	pc := parser.NewContext(opts...)
+	if path, ok := PagePathFromContext(ctx); ok {
+		pc.Set(linkPagePathKey, path)
+	}
+	doc := e.md.Parser().Parse(text.NewReader(source), parser.WithContext(pc))
+	return doc, linkErrors(pc)
+}
@@ -0,0 +1,134 @@
+package ktw
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	txt "text/template"
+)
+
+func TestMarkdownEngineOptions(t *testing.T) {
+	ctx := context.Background()
+	doc := md("Some \"quoted\" text.\n\n'''go\npackage main\n'''\n")
+	tests := []struct {
+		name    string
+		opts    []EngineOption
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "defaults",
+			want: []string{"&ldquo;quoted&rdquo;", `<span class="ln">1</span>`},
+		},
+		{
+			name:    "no typographer",
+			opts:    []EngineOption{WithTypographer(false)},
+			want:    []string{"&quot;quoted&quot;"},
+			notWant: []string{"&ldquo;"},
+		},
+		{
+			name:    "no line numbers",
+			opts:    []EngineOption{WithLineNumbers(false)},
+			notWant: []string{`class="ln"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := NewMarkdownEngine(tt.opts...).Render(ctx, doc, &buf); err != nil {
+				t.Fatalf("Got error: %+v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("Output does not contain %q:\n%s", want, buf.String())
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(buf.String(), notWant) {
+					t.Errorf("Output contains %q:\n%s", notWant, buf.String())
+				}
+			}
+		})
+	}
+}
+
+func TestMarkdownEngineConcurrent(t *testing.T) {
+	ctx := context.Background()
+	engine := NewMarkdownEngine()
+	var want bytes.Buffer
+	if err := engine.Render(ctx, md(testdoc1), &want); err != nil {
+		t.Fatalf("Got error: %+v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var got bytes.Buffer
+			if err := engine.Render(ctx, md(testdoc1), &got); err != nil {
+				t.Errorf("Got error: %+v", err)
+				return
+			}
+			if got.String() != want.String() {
+				t.Errorf("Got:\n%s\nWant:\n%s", got.String(), want.String())
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestPageConcurrent(t *testing.T) {
+	// Chroma options, as set from the config, are shared by every render.
+	engine := NewMarkdownEngine(
+		WithLineNumbers(false),
+		WithTabWidth(4),
+		WithHeadingAnchors(DefaultAnchorSymbol),
+		WithLinkRewriting(fstest.MapFS{"other.md": {}}, false),
+	)
+	tmpl, err := txt.New("").Delims("<<", ">>").Parse(`<title>{{.Title}}</title>{{sitetoc}}<< .Body >>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	site := SiteTOC{{Title: "Home", URL: "/index.html"}}
+	source := append([]byte("---\ntitle: Test\n---\n"), md(tocdoc+"\n{{toc}}\n\nSee [other](other.md).\n\n"+
+		"'''go {.diff}\na := 1\nb := 2\n:::\na := 1\nc := 3\n'''\n\n"+testdoc1)...)
+	render := func() (string, error) {
+		ctx := ContextWithPagePath(ContextWithHeadingIDs(context.Background(), NewHeadingIDs()), "index.md")
+		doc, err := engine.ParseDocumentContext(ctx, source)
+		if err != nil {
+			return "", err
+		}
+		pg := &Page{Metadata: doc.Frontmatter, Contents: []Renderer{doc}, Site: site, Template: tmpl}
+		var buf bytes.Buffer
+		err = pg.Render(ctx, &buf)
+		return buf.String(), err
+	}
+	want, err := render()
+	if err != nil {
+		t.Fatalf("Got error: %+v", err)
+	}
+	if !strings.Contains(want, `<span class="line del">`) {
+		t.Fatalf("Diff code block not rendered as a diff:\n%s", want)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := render()
+			if err != nil {
+				t.Errorf("Got error: %+v", err)
+				return
+			}
+			if got != want {
+				t.Errorf("Got:\n%s\nWant:\n%s", got, want)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,159 @@
+package ktw
+
+import (
+	"fmt"
+	"time"
+)
+
+// Frontmatter holds the metadata of a page, as parsed from the frontmatter of
+// its Markdown document. It keeps the full structure of the parsed metadata
+// (lists, dates, booleans and nested maps), so arbitrary keys are available
+// to templates as `{{ .Metadata.key }}`, while the well-known keys have typed
+// accessors such as `{{ .Metadata.Title }}`.
+type Frontmatter map[string]any
+
+// Keys with a typed accessor; everything else is returned by Params.
+var frontmatterKeys = map[string]bool{
+	"title":   true,
+	"date":    true,
+	"draft":   true,
+	"tags":    true,
+	"aliases": true,
+}
+
+// Date layouts accepted for dates written as strings.
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// localTime is implemented by the local dates and times parsed from TOML.
+type localTime interface {
+	AsTime(*time.Location) time.Time
+}
+
+// Get returns the value of key, or nil if it is not present.
+func (f Frontmatter) Get(key string) any {
+	return f[key]
+}
+
+// GetString returns the value of key as a string. Values that are not
+// strings are formatted with fmt, and a missing key returns "".
+func (f Frontmatter) GetString(key string) string {
+	switch v := f[key].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// GetStrings returns the value of key as a list of strings. A single value
+// is returned as a list of one.
+func (f Frontmatter) GetStrings(key string) []string {
+	switch v := f[key].(type) {
+	case nil:
+		return nil
+	case []string:
+		return v
+	case []any:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			list = append(list, fmt.Sprint(item))
+		}
+		return list
+	default:
+		return []string{f.GetString(key)}
+	}
+}
+
+// Title returns the "title" of the page.
+func (f Frontmatter) Title() string {
+	return f.GetString("title")
+}
+
+// Date returns the "date" of the page, or the zero time if it has none or
+// it cannot be parsed.
+func (f Frontmatter) Date() time.Time {
+	switch v := f["date"].(type) {
+	case time.Time:
+		return v
+	case localTime:
+		return v.AsTime(time.UTC)
+	case string:
+		for _, layout := range dateLayouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// Draft reports whether the page is marked as a "draft".
+func (f Frontmatter) Draft() bool {
+	switch v := f["draft"].(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true" || v == "yes"
+	}
+	return false
+}
+
+// Tags returns the "tags" of the page.
+func (f Frontmatter) Tags() []string {
+	return f.GetStrings("tags")
+}
+
+// Aliases returns the "aliases" of the page.
+func (f Frontmatter) Aliases() []string {
+	return f.GetStrings("aliases")
+}
+
+// Params returns all the keys that do not have a typed accessor.
+func (f Frontmatter) Params() map[string]any {
+	params := make(map[string]any, len(f))
+	for k, v := range f {
+		if !frontmatterKeys[k] {
+			params[k] = v
+		}
+	}
+	return params
+}
+
+// Merge returns a new Frontmatter with the keys of over merged onto those of
+// f. Keys in over win, except that nested maps present in both are merged
+// recursively. Neither f nor over is modified.
+func (f Frontmatter) Merge(over Frontmatter) Frontmatter {
+	merged := make(Frontmatter, len(f)+len(over))
+	for k, v := range f {
+		merged[k] = v
+	}
+	for k, v := range over {
+		base, ok1 := asFrontmatter(merged[k])
+		next, ok2 := asFrontmatter(v)
+		if ok1 && ok2 {
+			merged[k] = base.Merge(next)
+			continue
+		}
+		merged[k] = v
+	}
+	return merged
+}
+
+// asFrontmatter returns v as a Frontmatter if it is a nested map.
+func asFrontmatter(v any) (Frontmatter, bool) {
+	switch m := v.(type) {
+	case Frontmatter:
+		return m, true
+	case map[string]any:
+		return Frontmatter(m), true
+	}
+	return nil, false
+}
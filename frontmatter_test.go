@@ -0,0 +1,98 @@
+package ktw
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+	txt "text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestFrontmatter(t *testing.T) {
+	var fm Frontmatter
+	if err := yaml.Unmarshal([]byte(testfrontmatter), &fm); err != nil {
+		t.Fatalf("Got error: %+v", err)
+	}
+
+	if got, want := fm.Title(), "A Title"; got != want {
+		t.Errorf("Title() = %q, want %q", got, want)
+	}
+	if got, want := fm.Date(), time.Date(2024, 11, 3, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Date() = %v, want %v", got, want)
+	}
+	if !fm.Draft() {
+		t.Errorf("Draft() = false, want true")
+	}
+	if got, want := fm.Tags(), []string{"go", "web"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Tags() = %q, want %q", got, want)
+	}
+	if got, want := fm.Aliases(), []string{"/old/"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Aliases() = %q, want %q", got, want)
+	}
+	want := map[string]any{
+		"author": "Jane",
+		"series": Frontmatter{"name": "Intro", "part": 2},
+	}
+	if got := fm.Params(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Params() = %v, want %v", got, want)
+	}
+}
+
+func TestFrontmatterTemplate(t *testing.T) {
+	ctx := context.Background()
+	var fm Frontmatter
+	if err := yaml.Unmarshal([]byte(testfrontmatter), &fm); err != nil {
+		t.Fatalf("Got error: %+v", err)
+	}
+	tmpl := txt.Must(txt.New("").Delims("<<", ">>").Parse(
+		`{{ .Title }} by {{ .Metadata.author }} ({{ .Metadata.series.part }}):{{ range .Metadata.Tags }} {{ . }}{{ end }}`,
+	))
+	pg := &Page{Metadata: fm, Template: tmpl}
+	var buf bytes.Buffer
+
+	if err := pg.Render(ctx, &buf); err != nil {
+		t.Fatalf("Got error: %+v", err)
+	}
+	if got, want := buf.String(), "A Title by Jane (2): go web"; got != want {
+		t.Errorf("Got %q, want %q", got, want)
+	}
+}
+
+func TestFrontmatterMerge(t *testing.T) {
+	base := Frontmatter{
+		"style":  "article",
+		"author": Frontmatter{"name": "Jane", "email": "jane@example.com"},
+		"tags":   []any{"base"},
+	}
+	over := Frontmatter{
+		"title":  "Page",
+		"author": map[string]any{"name": "John"},
+		"tags":   []any{"page"},
+	}
+	want := Frontmatter{
+		"style":  "article",
+		"title":  "Page",
+		"author": Frontmatter{"name": "John", "email": "jane@example.com"},
+		"tags":   []any{"page"},
+	}
+	if got := base.Merge(over); !reflect.DeepEqual(got, want) {
+		t.Errorf("Merge() = %v, want %v", got, want)
+	}
+	if got := base["author"].(Frontmatter)["name"]; got != "Jane" {
+		t.Errorf("Merge() modified its receiver, author.name = %v", got)
+	}
+}
+
+var testfrontmatter = `title: A Title
+date: 2024-11-03
+draft: true
+tags: [go, web]
+aliases: /old/
+author: Jane
+series:
+  name: Intro
+  part: 2
+`
@@ -0,0 +1,217 @@
+package ktw
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// HeadingIDs is a registry of the ids of the headings of a page. Sharing it
+// between all the Markdown parts of a Page keeps their ids unique across the
+// whole page. It implements parser.IDs, and is safe for concurrent use.
+//
+// Auto-generated ids are made unique by adding a "-1", "-2", ... suffix.
+// Explicit ids, as in "## Heading {#custom-id}", are kept as they are, and a
+// warning is recorded if one is already in use.
+type HeadingIDs struct {
+	mu       sync.Mutex
+	ids      map[string]bool
+	warnings []string
+}
+
+// NewHeadingIDs returns an empty HeadingIDs.
+func NewHeadingIDs() *HeadingIDs {
+	return &HeadingIDs{ids: make(map[string]bool)}
+}
+
+// Generate implements parser.IDs.Generate, generating an id from the text of
+// a heading the same way as Goldmark does.
+func (h *HeadingIDs) Generate(value []byte, kind ast.NodeKind) []byte {
+	value = util.TrimRightSpace(util.TrimLeftSpace(value))
+	var id []byte
+	for i := 0; i < len(value); {
+		v := value[i]
+		l := util.UTF8Len(v)
+		i += int(l)
+		if l != 1 {
+			continue
+		}
+		if util.IsAlphaNumeric(v) {
+			if 'A' <= v && v <= 'Z' {
+				v += 'a' - 'A'
+			}
+			id = append(id, v)
+		} else if util.IsSpace(v) || v == '-' || v == '_' {
+			id = append(id, '-')
+		}
+	}
+	if len(id) == 0 {
+		if kind == ast.KindHeading {
+			id = []byte("heading")
+		} else {
+			id = []byte("id")
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.ids[string(id)] {
+		h.ids[string(id)] = true
+		return id
+	}
+	for i := 1; ; i++ {
+		next := fmt.Sprintf("%s-%d", id, i)
+		if !h.ids[next] {
+			h.ids[next] = true
+			return []byte(next)
+		}
+	}
+}
+
+// Put implements parser.IDs.Put, recording an explicit id.
+func (h *HeadingIDs) Put(value []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.ids[string(value)] {
+		h.warnings = append(h.warnings, fmt.Sprintf("duplicate heading id %q", value))
+		return
+	}
+	h.ids[string(value)] = true
+}
+
+// Warnings returns the warnings recorded so far, such as duplicate ids.
+func (h *HeadingIDs) Warnings() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), h.warnings...)
+}
+
+type headingIDsKey struct{}
+
+// ContextWithHeadingIDs returns a copy of ctx that carries ids. Markdown that
+// is parsed or rendered with the returned context registers its heading ids
+// within ids.
+func ContextWithHeadingIDs(ctx context.Context, ids *HeadingIDs) context.Context {
+	return context.WithValue(ctx, headingIDsKey{}, ids)
+}
+
+// HeadingIDsFromContext returns the HeadingIDs carried by ctx, or nil.
+func HeadingIDsFromContext(ctx context.Context) *HeadingIDs {
+	ids, _ := ctx.Value(headingIDsKey{}).(*HeadingIDs)
+	return ids
+}
+
+// KindHeadingAlias is the NodeKind of a HeadingAlias.
+var KindHeadingAlias = ast.NewNodeKind("HeadingAlias")
+
+// HeadingAlias is an inline node holding an extra id of a heading, such as
+// an id the heading used to have, so that links to it keep working.
+type HeadingAlias struct {
+	ast.BaseInline
+	ID string
+}
+
+// Kind implements ast.Node.Kind.
+func (n *HeadingAlias) Kind() ast.NodeKind {
+	return KindHeadingAlias
+}
+
+// Dump implements ast.Node.Dump.
+func (n *HeadingAlias) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"ID": n.ID}, nil)
+}
+
+// headingAliases implements heading aliases as a Goldmark extension.
+type headingAliases struct{}
+
+// NewHeadingAliases returns a Goldmark extension that renders the ids listed
+// in the "aliases" attribute of a heading as extra anchors, such as:
+//
+//	## New name {#new-name aliases="old-name,older-name"}
+//
+// which is rendered as:
+//
+//	<h2 id="new-name"><span id="old-name"></span><span id="older-name"></span>New name</h2>
+func NewHeadingAliases() goldmark.Extender {
+	return &headingAliases{}
+}
+
+func (e *headingAliases) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(
+		util.Prioritized(e, 500),
+	))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(e, 500),
+	))
+}
+
+// Transform implements parser.ASTTransformer.
+func (e *headingAliases) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		heading, ok := node.(*ast.Heading)
+		if !ok || !entering {
+			return ast.WalkContinue, nil
+		}
+		value, ok := heading.AttributeString("aliases")
+		if !ok {
+			return ast.WalkSkipChildren, nil
+		}
+		// The "aliases" attribute itself is not rendered, as it is not a
+		// global HTML attribute.
+		first := heading.FirstChild()
+		for _, alias := range attributeList(value) {
+			pc.IDs().Put([]byte(alias))
+			if first == nil {
+				heading.AppendChild(heading, &HeadingAlias{ID: alias})
+			} else {
+				heading.InsertBefore(heading, first, &HeadingAlias{ID: alias})
+			}
+		}
+		return ast.WalkSkipChildren, nil
+	})
+}
+
+// attributeList returns the values of an attribute holding a list, either as
+// a comma or space separated string, or as an array.
+func attributeList(value interface{}) []string {
+	var list []string
+	switch value := value.(type) {
+	case []byte:
+		list = strings.FieldsFunc(string(value), func(r rune) bool {
+			return r == ',' || r == ' '
+		})
+	case []interface{}:
+		for _, v := range value {
+			if v, ok := v.([]byte); ok {
+				list = append(list, string(v))
+			}
+		}
+	}
+	return list
+}
+
+// RegisterFuncs implements renderer.NodeRenderer.
+func (e *headingAliases) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindHeadingAlias, func(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			w.WriteString(`<span id="`)
+			w.Write(util.EscapeHTML([]byte(node.(*HeadingAlias).ID)))
+			w.WriteString(`"></span>`)
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+// Interface guards.
+var _ parser.IDs = (*HeadingIDs)(nil)
+var _ goldmark.Extender = (*headingAliases)(nil)
+var _ parser.ASTTransformer = (*headingAliases)(nil)
+var _ renderer.NodeRenderer = (*headingAliases)(nil)
@@ -0,0 +1,133 @@
+package ktw
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHeadingIDs(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name     string
+		contents []Renderer
+		want     []string
+		warnings []string
+	}{
+		{
+			name:     "unique across parts",
+			contents: []Renderer{md("# Intro\n\n## Usage\n"), md("# Intro\n\n## Usage\n")},
+			want: []string{
+				`<h1 id="intro">Intro</h1>`,
+				`<h2 id="usage">Usage</h2>`,
+				`<h1 id="intro-1">Intro</h1>`,
+				`<h2 id="usage-1">Usage</h2>`,
+			},
+		},
+		{
+			name:     "explicit id",
+			contents: []Renderer{md("## Usage {#use}\n\n## Use\n")},
+			want: []string{
+				`<h2 id="use">Usage</h2>`,
+				`<h2 id="use-1">Use</h2>`,
+			},
+		},
+		{
+			name:     "duplicate explicit id",
+			contents: []Renderer{md("## Usage\n"), md("## How to use {#usage}\n")},
+			want: []string{
+				`<h2 id="usage">Usage</h2>`,
+				`<h2 id="usage">How to use</h2>`,
+			},
+			warnings: []string{`duplicate heading id "usage"`},
+		},
+		{
+			name:     "aliases",
+			contents: []Renderer{md("## New name {#new aliases=\"old,older\"}\n\n## Empty {#empty aliases=[\"gone\"]}\n")},
+			want: []string{
+				`<h2 id="new"><span id="old"></span><span id="older"></span>New name</h2>`,
+				`<h2 id="empty"><span id="gone"></span>Empty</h2>`,
+			},
+		},
+		{
+			name:     "duplicate alias",
+			contents: []Renderer{md("## Old\n\n## New {aliases=\"old\"}\n")},
+			want:     []string{`<h2 id="new"><span id="old"></span>New</h2>`},
+			warnings: []string{`duplicate heading id "old"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pg := &Page{Contents: tt.contents}
+			var buf bytes.Buffer
+			if err := pg.Render(ctx, &buf); err != nil {
+				t.Fatalf("Got error: %+v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("Output does not contain %q:\n%s", want, buf.String())
+				}
+			}
+			if !reflect.DeepEqual(pg.Warnings, tt.warnings) {
+				t.Errorf("Got warnings %q, want %q", pg.Warnings, tt.warnings)
+			}
+		})
+	}
+}
+
+func TestHeadingIDsDocument(t *testing.T) {
+	ids := NewHeadingIDs()
+	ctx := ContextWithHeadingIDs(context.Background(), ids)
+	doc, err := DefaultMarkdownEngine().ParseDocumentContext(ctx, []byte("---\ntitle: T\n---\n# Intro\n"))
+	if err != nil {
+		t.Fatalf("Got error: %+v", err)
+	}
+	pg := &Page{Contents: []Renderer{doc, md("# Intro\n")}}
+	var buf bytes.Buffer
+	if err := pg.Render(ctx, &buf); err != nil {
+		t.Fatalf("Got error: %+v", err)
+	}
+	for _, want := range []string{`<h1 id="intro">Intro</h1>`, `<h1 id="intro-1">Intro</h1>`} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Output does not contain %q:\n%s", want, buf.String())
+		}
+	}
+	want := TOC{
+		{Level: 1, Text: "Intro", ID: "intro"},
+		{Level: 1, Text: "Intro", ID: "intro-1"},
+	}
+	if !reflect.DeepEqual(pg.TOC, want) {
+		t.Errorf("Got TOC:\n%s\nwant:\n%s", pg.TOC.HTML(), want.HTML())
+	}
+}
+
+func TestHeadingIDsParsedDocuments(t *testing.T) {
+	docA, err := ParseDocument([]byte("---\ntitle: A\n---\n## Intro\n"))
+	if err != nil {
+		t.Fatalf("Got error: %+v", err)
+	}
+	docB, err := ParseDocument([]byte("## Intro {#intro}\n"))
+	if err != nil {
+		t.Fatalf("Got error: %+v", err)
+	}
+	pg := &Page{Contents: []Renderer{docA, docB, md("## Intro\n")}}
+	var buf bytes.Buffer
+	if err := pg.Render(context.Background(), &buf); err != nil {
+		t.Fatalf("Got error: %+v", err)
+	}
+	for _, want := range []string{`<h2 id="intro">Intro</h2>`, `<h2 id="intro-1">Intro</h2>`} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Output does not contain %q:\n%s", want, buf.String())
+		}
+	}
+	if want := []string{`duplicate heading id "intro"`}; !reflect.DeepEqual(pg.Warnings, want) {
+		t.Errorf("Got warnings %q, want %q", pg.Warnings, want)
+	}
+
+	// The parsed documents are left as they are.
+	if want := (TOC{{Level: 2, Text: "Intro", ID: "intro"}}); !reflect.DeepEqual(docA.TOC(), want) {
+		t.Errorf("Got TOC:\n%s\nwant:\n%s", docA.TOC().HTML(), want.HTML())
+	}
+}
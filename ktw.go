@@ -22,9 +22,21 @@ type Renderer interface {
 // all its contents.
 type Page struct {
 	Title    string
-	Metadata map[string]string
+	Metadata Frontmatter
 	Contents []Renderer
 
+	// TOC is the table of contents of the page, available to templates as
+	// ".TOC", and as "{{toc}}" (see TOCPlaceholderText). If empty, it is
+	// collected from the Markdown contents as they are rendered.
+	TOC TOC
+	// Site is the table of contents of the whole site, available to templates
+	// as ".Site", and as "{{sitetoc}}".
+	Site SiteTOC
+
+	// Warnings holds the warnings of the last Render, such as duplicate
+	// heading ids.
+	Warnings []string
+
 	// text.Template as we only use it to embed the Markdown rendered HTML
 	// within `<< .Markdown >>`. The resulting document is also a template
 	// and will be rendered using `package "html/template"` as a final pass
@@ -55,6 +67,9 @@ func defaultTemplate(title string) (*txt.Template, error) {
 // frontmatter as input to the template. Find the template files by
 // evaluating the provided, and parsed, configuration file.
 func (p *Page) Render(ctx context.Context, w io.Writer) error {
+	if p.Title == "" {
+		p.Title = p.Metadata.Title()
+	}
 	if p.Template == nil {
 		tmpl, err := defaultTemplate(p.Title)
 		if err != nil {
@@ -63,6 +78,17 @@ func (p *Page) Render(ctx context.Context, w io.Writer) error {
 		p.Template = tmpl
 	}
 
+	ids := HeadingIDsFromContext(ctx)
+	if ids == nil {
+		ids = NewHeadingIDs()
+		ctx = ContextWithHeadingIDs(ctx, ids)
+	}
+	var toc *tocCollector
+	if len(p.TOC) == 0 {
+		toc = &tocCollector{}
+		ctx = withTOCCollector(ctx, toc)
+	}
+
 	// Render all Markdown present.
 	var body strings.Builder
 	for _, item := range p.Contents {
@@ -70,6 +96,10 @@ func (p *Page) Render(ctx context.Context, w io.Writer) error {
 			return err
 		}
 	}
+	if toc != nil {
+		p.TOC = toc.toc
+	}
+	p.Warnings = ids.Warnings()
 
 	// Use text/template to render the template (provided or generated above).
 	var buf bytes.Buffer
@@ -78,7 +108,10 @@ func (p *Page) Render(ctx context.Context, w io.Writer) error {
 	}
 
 	// Treat the final document as an html/template document and render again.
-	tmpl, err := template.New("").Parse(buf.String())
+	tmpl, err := template.New("").Funcs(template.FuncMap{
+		"toc":     p.TOC.HTML,
+		"sitetoc": p.Site.HTML,
+	}).Parse(buf.String())
 	if err != nil {
 		return err
 	}
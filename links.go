@@ -0,0 +1,119 @@
+package ktw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+type pagePathKey struct{}
+
+// ContextWithPagePath returns a copy of ctx that carries the path of the page
+// being parsed or rendered, relative to the root of the site (in slash
+// separated form). It is used to resolve relative links (see
+// WithLinkRewriting).
+func ContextWithPagePath(ctx context.Context, path string) context.Context {
+	return context.WithValue(ctx, pagePathKey{}, path)
+}
+
+// PagePathFromContext returns the path of the page carried by ctx, if any.
+func PagePathFromContext(ctx context.Context) (string, bool) {
+	path, ok := ctx.Value(pagePathKey{}).(string)
+	return path, ok
+}
+
+var (
+	linkPagePathKey = parser.NewContextKey()
+	linkErrorsKey   = parser.NewContextKey()
+)
+
+// linkRewriter implements the rewriting of links to Markdown files as a
+// Goldmark extension.
+type linkRewriter struct {
+	fsys   fs.FS
+	pretty bool
+}
+
+// NewLinkRewriter returns a Goldmark extension that rewrites relative links to
+// Markdown files, such as "../article-02/index.md#usage", into links to the
+// HTML files generated from them, such as "../article-02/index.html#usage".
+// With pretty set, links to "index.html" files link to their directory
+// instead, such as "../article-02/#usage".
+//
+// The targets of the links are looked up in fsys, relative to the path of
+// the page being parsed, as set in the parser.Context by the MarkdownEngine
+// (see ContextWithPagePath). Links to missing files are reported as errors
+// by the MarkdownEngine. Without a page path, the links are rewritten without
+// being checked.
+func NewLinkRewriter(fsys fs.FS, pretty bool) goldmark.Extender {
+	return &linkRewriter{fsys: fsys, pretty: pretty}
+}
+
+func (e *linkRewriter) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(
+		util.Prioritized(e, 500),
+	))
+}
+
+// Transform implements parser.ASTTransformer.
+func (e *linkRewriter) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	page, _ := pc.Get(linkPagePathKey).(string)
+	ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		link, ok := node.(*ast.Link)
+		if !ok || !entering {
+			return ast.WalkContinue, nil
+		}
+		u, err := url.Parse(string(link.Destination))
+		if err != nil || u.Scheme != "" || u.Host != "" || !strings.HasSuffix(u.Path, ".md") {
+			return ast.WalkContinue, nil
+		}
+
+		if page != "" && e.fsys != nil {
+			target := strings.TrimPrefix(u.Path, "/")
+			if !strings.HasPrefix(u.Path, "/") {
+				target = path.Join(path.Dir(page), u.Path)
+			}
+			if _, err := fs.Stat(e.fsys, target); err != nil {
+				addLinkError(pc, fmt.Errorf("broken link to %q", link.Destination))
+				return ast.WalkContinue, nil
+			}
+		}
+
+		u.Path = strings.TrimSuffix(u.Path, ".md") + ".html"
+		if e.pretty && path.Base(u.Path) == "index.html" {
+			u.Path = strings.TrimSuffix(u.Path, "index.html")
+			if u.Path == "" {
+				u.Path = "./"
+			}
+		}
+		u.RawPath = ""
+		link.Destination = []byte(u.String())
+		return ast.WalkContinue, nil
+	})
+}
+
+// addLinkError records err within pc.
+func addLinkError(pc parser.Context, err error) {
+	errs, _ := pc.Get(linkErrorsKey).([]error)
+	pc.Set(linkErrorsKey, append(errs, err))
+}
+
+// linkErrors returns the errors recorded within pc, joined, or nil.
+func linkErrors(pc parser.Context) error {
+	errs, _ := pc.Get(linkErrorsKey).([]error)
+	return errors.Join(errs...)
+}
+
+// Interface guards.
+var _ goldmark.Extender = (*linkRewriter)(nil)
+var _ parser.ASTTransformer = (*linkRewriter)(nil)
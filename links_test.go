@@ -0,0 +1,92 @@
+package ktw
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLinkRewriting(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.md":                 {},
+		"blog/article-01/index.md": {},
+		"blog/article-02/index.md": {},
+		"blog/article-02/notes.md": {},
+	}
+	tests := []struct {
+		name   string
+		page   string
+		pretty bool
+		doc    string
+		want   string
+		err    string
+	}{
+		{
+			name: "relative",
+			page: "blog/article-01/index.md",
+			doc:  "[next](../article-02/index.md)",
+			want: `<a href="../article-02/index.html">next</a>`,
+		},
+		{
+			name: "fragment",
+			page: "blog/article-01/index.md",
+			doc:  "[notes](../article-02/notes.md#usage)",
+			want: `<a href="../article-02/notes.html#usage">notes</a>`,
+		},
+		{
+			name:   "pretty",
+			page:   "blog/article-01/index.md",
+			pretty: true,
+			doc:    "[next](../article-02/index.md#usage) [notes](../article-02/notes.md) [self](index.md)",
+			want:   `<a href="../article-02/#usage">next</a> <a href="../article-02/notes.html">notes</a> <a href="./">self</a>`,
+		},
+		{
+			name: "site root",
+			page: "blog/article-01/index.md",
+			doc:  "[home](/index.md)",
+			want: `<a href="/index.html">home</a>`,
+		},
+		{
+			name: "untouched",
+			page: "index.md",
+			doc:  "[a](https://example.com/a.md) [b](notes.txt) [c](#top)",
+			want: `<a href="https://example.com/a.md">a</a> <a href="notes.txt">b</a> <a href="#top">c</a>`,
+		},
+		{
+			name: "no page",
+			doc:  "[missing](missing.md)",
+			want: `<a href="missing.html">missing</a>`,
+		},
+		{
+			name: "missing",
+			page: "blog/article-01/index.md",
+			doc:  "[a](../article-03/index.md) [b](../../../outside.md)",
+			err:  `broken link to "../article-03/index.md"` + "\n" + `broken link to "../../../outside.md"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.page != "" {
+				ctx = ContextWithPagePath(ctx, tt.page)
+			}
+			engine := NewMarkdownEngine(WithLinkRewriting(fsys, tt.pretty))
+			var buf bytes.Buffer
+			err := engine.Render(ctx, Markdown(tt.doc), &buf)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("Got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Got error: %+v", err)
+			}
+			if !strings.Contains(buf.String(), tt.want) {
+				t.Errorf("Output does not contain %q:\n%s", tt.want, buf.String())
+			}
+		})
+	}
+}
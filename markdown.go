@@ -1,126 +1,307 @@
 package ktw
 
 import (
+	"bytes"
 	"context"
 	"io"
+	"strconv"
+	"strings"
 
 	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
-	d2 "github.com/nuttyswiss/goldmark-d2"
 	"github.com/yuin/goldmark"
 	highlighting "github.com/yuin/goldmark-highlighting/v2"
-	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/ast"
 	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
 	gmhtml "github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
 	"github.com/yuin/goldmark/util"
 )
 
 type Markdown []byte
 
-// Render Markdown into HTML.
-//
-// TODO: use github.com/abhinav/goldmark-frontmatter to parse the
-// frontmatter and pass that back to the callee, so they can use it
-// to run an appropriate template with the frontmatter variables as
-// input.
+// Render Markdown into HTML, using the default MarkdownEngine. The Markdown
+// must not contain frontmatter, use ParseDocument to parse a document that
+// may have frontmatter.
 func (m Markdown) Render(ctx context.Context, w io.Writer) error {
-	md := goldmark.New(
-		goldmark.WithExtensions(
-			extension.GFM,
-			extension.Footnote,
-			extension.Strikethrough,
-			extension.Table,
-			extension.TaskList,
-			extension.Typographer,
-			// TODO: Install D2 extension... it seems github.com/FurqanSoftware/goldmark-d2
-			// has an error with the included/used slog package. The authors must have some
-			// sort of workspace override. As I'm not quite in need of the D2 extension, I'll
-			// leave it as a todo at this point. Note, this would be as a means to surplant
-			// my current use of Excalidraw+.
-			&d2.Extender{
-				// Layout:  d2elklayout.Layout,
-				// ThemeID: &d2themescatalog.Terminal.ID,
-			},
-			NewCustomCodeHighlight(),
-		),
-		goldmark.WithParserOptions(
-			parser.WithAttribute(),
-			parser.WithAutoHeadingID(),
-			parser.WithBlockParsers(
-				util.Prioritized(NewInfoBlockParser(), 1000),
-				util.Prioritized(NewNoteBlockParser(), 1000),
-				util.Prioritized(NewWarningBlockParser(), 1000),
-			),
-		),
-		goldmark.WithRendererOptions(
-			gmhtml.WithUnsafe(),
-		),
-	)
-	return md.Convert(m, w)
+	return DefaultMarkdownEngine().Render(ctx, m, w)
 }
 
 // CustomCodeHighlight implements a custom fenced code highlighter
 // that uses Chroma under the hood, but also implements class and
-// general HTML attribute handling.
+// general HTML attribute handling, as well as diff code blocks.
 type CustomCodeHighlight struct {
-	goldmark.Extender
+	formatOptions []chromahtml.Option
 }
 
-// NewCustomCodeHighlight returns a wrapped Chroma highlight extension.
-func NewCustomCodeHighlight() goldmark.Extender {
-	wrapper := func(w util.BufWriter, context highlighting.CodeBlockContext, entering bool) {
-		if entering {
-			w.WriteString(`<pre class="chroma">`)
-			lang, ok := context.Language()
-			if !ok {
-				lang = []byte("unknown")
-			}
-			// No attributes, write simple option
-			if context.Attributes() == nil {
-				w.WriteString(`<code class="language-`)
-				w.Write(lang)
-				w.WriteString(`">`)
-				return
-			}
+// NewCustomCodeHighlight returns a wrapped Chroma highlight extension. The
+// given options are applied after the defaults (a tab width of 4, and line
+// numbers), and so override them.
+func NewCustomCodeHighlight(opts ...chromahtml.Option) goldmark.Extender {
+	return &CustomCodeHighlight{
+		formatOptions: append([]chromahtml.Option{
+			chromahtml.TabWidth(4),
+			chromahtml.WithClasses(true),
+			chromahtml.WithLineNumbers(true),
+			chromahtml.WithPreWrapper(preWrapper{}),
+		}, opts...),
+	}
+}
+
+// Extend implements goldmark.Extender.
+func (e *CustomCodeHighlight) Extend(m goldmark.Markdown) {
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(&codeBlockRenderer{
+			highlight: highlighting.NewHTMLRenderer(
+				highlighting.WithFormatOptions(e.formatOptions...),
+				highlighting.WithWrapperRenderer(codeWrapper),
+				highlighting.WithCodeBlockOptions(codeBlockOptions),
+			),
+			formatOptions: e.formatOptions,
+		}, 200),
+	))
+}
 
-			// Handle code with attributes
-			w.WriteString(`<code class="language-`)
-			w.Write(lang)
-			if attr, ok := context.Attributes().GetString("class"); ok {
-				w.WriteString(` `)
-				w.Write(attr.([]byte))
-				w.WriteString(`"`)
+// codeWrapper writes the "<pre>" and "<code>" elements around a code block.
+func codeWrapper(w util.BufWriter, context highlighting.CodeBlockContext, entering bool) {
+	if !entering {
+		w.WriteString(`</code></pre>`)
+		return
+	}
+	lang, _ := context.Language()
+	var attrs []ast.Attribute
+	if context.Attributes() != nil {
+		attrs = context.Attributes().All()
+	}
+	w.WriteString(`<pre class="chroma"><code`)
+	writeCodeAttributes(w, lang, "", attrs)
+	w.WriteString(`>`) // close out <code>
+}
+
+// codeBlockOptions returns the Chroma options for a single code block, as set
+// by the attributes of its fence:
+//
+//	```go {hl_lines="3-5,9" linenostart=42 linenos=false}
+//
+// The lines to highlight are counted from the first line of the code block,
+// whatever its starting line number.
+func codeBlockOptions(c highlighting.CodeBlockContext) []chromahtml.Option {
+	attrs := c.Attributes()
+	if attrs == nil {
+		return nil
+	}
+
+	var opts []chromahtml.Option
+	base := 1
+	if v, ok := attrs.GetString("linenostart"); ok {
+		if n, ok := attributeInt(v); ok {
+			base = n
+			opts = append(opts, chromahtml.BaseLineNumber(base))
+		}
+	}
+	if v, ok := attrs.GetString("linenos"); ok {
+		if value, ok := v.([]byte); ok {
+			switch string(value) {
+			case "false":
+				opts = append(opts, chromahtml.WithLineNumbers(false))
+			case "true":
+				opts = append(opts, chromahtml.WithLineNumbers(true))
 			}
-			// Add in all the other possible attributes...
-			for _, attr := range context.Attributes().All() {
-				if !gmhtml.CodeAttributeFilter.Contains(attr.Name) {
-					continue
+		}
+	}
+	if v, ok := attrs.GetString("hl_lines"); ok {
+		if value, ok := v.([]byte); ok {
+			var ranges [][2]int
+			for _, field := range strings.Split(string(value), ",") {
+				lo, hi, found := strings.Cut(strings.TrimSpace(field), "-")
+				if !found {
+					hi = lo
 				}
-				if string(attr.Name) == "class" {
+				start, err1 := strconv.Atoi(strings.TrimSpace(lo))
+				end, err2 := strconv.Atoi(strings.TrimSpace(hi))
+				if err1 != nil || err2 != nil || start > end {
 					continue
 				}
-				w.WriteString(` `)
-				w.Write(attr.Name)
-				w.WriteString(`="`)
-				w.Write(attr.Value.([]byte))
-				w.WriteString(`"`)
+				ranges = append(ranges, [2]int{start + base - 1, end + base - 1})
 			}
-			w.WriteString(`>`) // close out <code>
-		} else {
-			w.WriteString(`</code></pre>`)
+			opts = append(opts, chromahtml.HighlightLines(ranges))
 		}
 	}
+	return opts
+}
 
-	return &CustomCodeHighlight{
-		Extender: highlighting.NewHighlighting(
-			highlighting.WithFormatOptions(
-				chromahtml.TabWidth(4),
-				chromahtml.WithClasses(true),
-				chromahtml.WithLineNumbers(true),
-				chromahtml.WithPreWrapper(preWrapper{}),
-			),
-			highlighting.WithWrapperRenderer(wrapper),
-		),
+// attributeInt returns the value of an attribute as an int. Numbers are
+// parsed as float64, but may also be given as strings.
+func attributeInt(v interface{}) (int, bool) {
+	switch value := v.(type) {
+	case float64:
+		return int(value), true
+	case []byte:
+		n, err := strconv.Atoi(string(value))
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// writeCodeAttributes writes the attributes of the element wrapping a code
+// block: a class attribute holding class (if any), the "language-" class and
+// any classes in attrs, followed by the other attributes in attrs that are
+// allowed on a "<code>" element (including "data-" attributes). All values
+// are escaped.
+func writeCodeAttributes(w util.BufWriter, language []byte, class string, attrs []ast.Attribute) {
+	// A fence with attributes but no language, as in "```{.x}", has the
+	// attributes as its language.
+	if len(language) == 0 || language[0] == '{' {
+		language = []byte("unknown")
+	}
+	classes := []string{"language-" + string(language)}
+	if class != "" {
+		classes = append([]string{class}, classes...)
+	}
+	for _, attr := range attrs {
+		if value, ok := attr.Value.([]byte); ok && string(attr.Name) == "class" {
+			classes = append(classes, strings.Fields(string(value))...)
+		}
+	}
+	w.WriteString(` class="`)
+	w.Write(util.EscapeHTML([]byte(strings.Join(classes, " "))))
+	w.WriteString(`"`)
+
+	for _, attr := range attrs {
+		if string(attr.Name) == "class" {
+			continue
+		}
+		if !bytes.HasPrefix(attr.Name, []byte("data-")) && !gmhtml.CodeAttributeFilter.Contains(attr.Name) {
+			continue
+		}
+		value, ok := attr.Value.([]byte)
+		if !ok {
+			continue
+		}
+		w.WriteString(` `)
+		w.Write(attr.Name)
+		w.WriteString(`="`)
+		w.Write(util.EscapeHTML(value))
+		w.WriteString(`"`)
+	}
+}
+
+// codeBlockRenderer renders fenced code blocks. Diff code blocks are rendered
+// by renderDiff, and all others by the Chroma highlighting renderer.
+type codeBlockRenderer struct {
+	highlight     renderer.NodeRenderer
+	render        renderer.NodeRendererFunc
+	formatOptions []chromahtml.Option
+}
+
+// SetOption implements renderer.SetOptioner, passing the options on to the
+// highlighting renderer.
+func (r *codeBlockRenderer) SetOption(name renderer.OptionName, value interface{}) {
+	if so, ok := r.highlight.(renderer.SetOptioner); ok {
+		so.SetOption(name, value)
+	}
+}
+
+// RegisterFuncs implements renderer.NodeRenderer.
+func (r *codeBlockRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	r.highlight.RegisterFuncs(registerFunc(func(kind ast.NodeKind, f renderer.NodeRendererFunc) {
+		if kind == ast.KindFencedCodeBlock {
+			r.render = f
+		}
+	}))
+	reg.Register(ast.KindFencedCodeBlock, r.renderFencedCodeBlock)
+}
+
+func (r *codeBlockRenderer) renderFencedCodeBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	n := node.(*ast.FencedCodeBlock)
+	attrs := fenceAttributes(n, source)
+	if entering && hasClass(attrs, "diff") {
+		if r.renderDiff(w, source, n, attrs) {
+			return ast.WalkContinue, nil
+		}
+	}
+	// The highlighting renderer ignores the attributes of a fence without a
+	// language, as in "```{.x}", unless they are set on the node.
+	if entering && n.Attributes() == nil {
+		for _, attr := range attrs {
+			n.SetAttribute(attr.Name, attr.Value)
+		}
+	}
+	return r.render(w, source, node, entering)
+}
+
+// registerFunc implements renderer.NodeRendererFuncRegisterer with a func.
+type registerFunc func(kind ast.NodeKind, f renderer.NodeRendererFunc)
+
+func (r registerFunc) Register(kind ast.NodeKind, f renderer.NodeRendererFunc) { r(kind, f) }
+
+// fenceAttributes returns the attributes given in the info string of a fenced
+// code block, as in "```go {.diff}".
+func fenceAttributes(n *ast.FencedCodeBlock, source []byte) parser.Attributes {
+	if n.Info == nil {
+		return nil
+	}
+	info := n.Info.Segment.Value(source)
+	start := bytes.IndexByte(info, '{')
+	if start < 0 {
+		return nil
+	}
+	attrs, _ := parser.ParseAttributes(text.NewReader(info[start:]))
+	return attrs
+}
+
+// hasClass reports whether the class attribute within attrs contains class.
+func hasClass(attrs parser.Attributes, class string) bool {
+	for _, attr := range attrs {
+		if string(attr.Name) != "class" {
+			continue
+		}
+		value, _ := attr.Value.([]byte)
+		for _, c := range strings.Fields(string(value)) {
+			if c == class {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// codeBlockContext implements highlighting.CodeBlockContext.
+type codeBlockContext struct {
+	language []byte
+	attrs    parser.Attributes
+}
+
+func (c *codeBlockContext) Language() ([]byte, bool) { return c.language, c.language != nil }
+
+func (c *codeBlockContext) Highlighted() bool { return true }
+
+func (c *codeBlockContext) Attributes() highlighting.ImmutableAttributes {
+	if c.attrs == nil {
+		return nil
+	}
+	return c
+}
+
+func (c *codeBlockContext) Get(name []byte) (interface{}, bool) {
+	return c.GetString(string(name))
+}
+
+func (c *codeBlockContext) GetString(name string) (interface{}, bool) {
+	for _, attr := range c.attrs {
+		if string(attr.Name) == name {
+			return attr.Value, true
+		}
+	}
+	return nil, false
+}
+
+func (c *codeBlockContext) All() []ast.Attribute {
+	all := make([]ast.Attribute, 0, len(c.attrs))
+	for _, attr := range c.attrs {
+		all = append(all, ast.Attribute{Name: attr.Name, Value: attr.Value})
 	}
+	return all
 }
 
 type preWrapper struct{}
@@ -132,3 +313,6 @@ func (p preWrapper) End(code bool) string { return "" }
 // Interface guard.
 var _ Renderer = (*Markdown)(nil)
 var _ chromahtml.PreWrapper = (*preWrapper)(nil)
+var _ renderer.NodeRenderer = (*codeBlockRenderer)(nil)
+var _ renderer.SetOptioner = (*codeBlockRenderer)(nil)
+var _ highlighting.CodeBlockContext = (*codeBlockContext)(nil)
@@ -63,3 +63,128 @@ func main() {
 }
 '''{.good}
 `
+
+func TestCodeBlockOptions(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name    string
+		doc     string
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "hl_lines and linenostart",
+			doc:  "'''go {hl_lines=\"2-3,5\" linenostart=42}\na\nb\nc\nd\ne\n'''",
+			want: []string{
+				`<span class="line"><span class="ln">42</span>`,
+				`<span class="line hl"><span class="ln">43</span>`,
+				`<span class="line hl"><span class="ln">44</span>`,
+				`<span class="line"><span class="ln">45</span>`,
+				`<span class="line hl"><span class="ln">46</span>`,
+			},
+		},
+		{
+			name:    "linenos=false",
+			doc:     "'''go {linenos=false}\na\n'''",
+			want:    []string{`<span class="line"><span class="cl">`},
+			notWant: []string{`class="ln"`},
+		},
+		{
+			name:    "linenos=\"false\"",
+			doc:     "'''go {linenos=\"false\" hl_lines=\"1\"}\na\n'''",
+			want:    []string{`<span class="line hl"><span class="cl">`},
+			notWant: []string{`class="ln"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := md(tt.doc).Render(ctx, &buf); err != nil {
+				t.Fatalf("Got error: %+v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("Output does not contain %q:\n%s", want, buf.String())
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(buf.String(), notWant) {
+					t.Errorf("Output contains %q:\n%s", notWant, buf.String())
+				}
+			}
+		})
+	}
+}
+
+func TestCodeAttributes(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		doc  string
+		want string
+	}{
+		{
+			name: "no attributes",
+			doc:  "'''go\na\n'''",
+			want: `<pre class="chroma"><code class="language-go">`,
+		},
+		{
+			name: "no language",
+			doc:  "'''\na\n'''",
+			want: `<pre class="chroma"><code class="language-unknown">`,
+		},
+		{
+			name: "class only",
+			doc:  "'''go {.good}\na\n'''",
+			want: `<pre class="chroma"><code class="language-go good">`,
+		},
+		{
+			name: "classes without language",
+			doc:  "'''{.good .better}\na\n'''",
+			want: `<pre class="chroma"><code class="language-unknown good better">`,
+		},
+		{
+			name: "id only",
+			doc:  "'''go {#main}\na\n'''",
+			want: `<pre class="chroma"><code class="language-go" id="main">`,
+		},
+		{
+			name: "class and id",
+			doc:  "'''go {#main .good}\na\n'''",
+			want: `<pre class="chroma"><code class="language-go good" id="main">`,
+		},
+		{
+			name: "other attributes",
+			doc:  "'''go {.good title=\"Example\" data-file=\"main.go\"}\na\n'''",
+			want: `<pre class="chroma"><code class="language-go good" title="Example" data-file="main.go">`,
+		},
+		{
+			name: "disallowed and option attributes",
+			doc:  "'''go {#main onclick=\"alert(1)\" linenostart=3 hl_lines=\"1\"}\na\n'''",
+			want: `<pre class="chroma"><code class="language-go" id="main">`,
+		},
+		{
+			name: "escaped values",
+			doc:  "'''go {class=\"\\\"><script>\" title=\"a<b & \\\"c\\\"\"}\na\n'''",
+			want: `<pre class="chroma"><code class="language-go &quot;&gt;&lt;script&gt;" title="a&lt;b &amp; &quot;c&quot;">`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := md(tt.doc).Render(ctx, &buf); err != nil {
+				t.Fatalf("Got error: %+v", err)
+			}
+			// Compare up to the end of the opening "<code>" tag.
+			got := buf.String()
+			if i := strings.Index(got, "<code"); i >= 0 {
+				if j := strings.IndexByte(got[i:], '>'); j >= 0 {
+					got = got[:i+j+1]
+				}
+			}
+			if got != tt.want {
+				t.Errorf("Got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package ktw
+
+import (
+	"bytes"
+	"context"
+	"html"
+	"html/template"
+	"strings"
+	"sync"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// TOCPlaceholderText is the text of a paragraph that is replaced by the
+// table of contents of the page.
+const TOCPlaceholderText = "{{toc}}"
+
+// TOCEntry is a heading in a table of contents, along with the headings
+// nested below it.
+type TOCEntry struct {
+	Level    int    // 1 for "<h1>", 2 for "<h2>", ...
+	Text     string // the plain text of the heading
+	ID       string // the id attribute of the heading, if any
+	Children TOC
+}
+
+// TOC is a table of contents: the top level headings of a document, each with
+// the headings nested below it. A heading is nested below the nearest heading
+// before it with a lower level, so a document starting with a "<h2>" has that
+// "<h2>" at its top level.
+type TOC []*TOCEntry
+
+// ExtractTOC returns the table of contents of a parsed Markdown document,
+// where source is the Markdown it was parsed from.
+func ExtractTOC(doc ast.Node, source []byte) TOC {
+	var toc TOC
+	var stack []*TOCEntry
+	ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		heading, ok := node.(*ast.Heading)
+		if !ok || !entering {
+			return ast.WalkContinue, nil
+		}
+		entry := &TOCEntry{
+			Level: heading.Level,
+			Text:  headingText(heading, source),
+		}
+		if id, ok := heading.AttributeString("id"); ok {
+			if id, ok := id.([]byte); ok {
+				entry.ID = string(id)
+			}
+		}
+
+		for len(stack) > 0 && stack[len(stack)-1].Level >= entry.Level {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			toc = append(toc, entry)
+		} else {
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, entry)
+		}
+		stack = append(stack, entry)
+		return ast.WalkSkipChildren, nil
+	})
+	return toc
+}
+
+// headingText returns the plain text of a heading, without any markup.
+func headingText(n ast.Node, source []byte) string {
+	var buf strings.Builder
+	ast.Walk(n, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch node := node.(type) {
+		case *ast.Text:
+			buf.Write(node.Segment.Value(source))
+		case *ast.String:
+			// Typographer replacements are HTML entities, such as "&rsquo;".
+			buf.WriteString(html.UnescapeString(string(node.Value)))
+		case *ast.RawHTML:
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	return buf.String()
+}
+
+// HTML returns the table of contents as nested "<ul>" lists of links to the
+// headings, within a `<nav class="toc">` element.
+func (t TOC) HTML() template.HTML {
+	if len(t) == 0 {
+		return ""
+	}
+	var buf bytes.Buffer
+	buf.WriteString(`<nav class="toc">` + "\n")
+	t.writeList(&buf)
+	buf.WriteString("</nav>\n")
+	return template.HTML(buf.String())
+}
+
+func (t TOC) writeList(buf *bytes.Buffer) {
+	buf.WriteString("<ul>\n")
+	for _, entry := range t {
+		buf.WriteString("<li>")
+		if entry.ID != "" {
+			buf.WriteString(`<a href="#` + template.HTMLEscapeString(entry.ID) + `">`)
+			buf.WriteString(template.HTMLEscapeString(entry.Text))
+			buf.WriteString("</a>")
+		} else {
+			buf.WriteString(template.HTMLEscapeString(entry.Text))
+		}
+		if len(entry.Children) != 0 {
+			buf.WriteString("\n")
+			entry.Children.writeList(buf)
+		}
+		buf.WriteString("</li>\n")
+	}
+	buf.WriteString("</ul>\n")
+}
+
+// PageTOC is an entry of a SiteTOC: a page, its URL and its table of contents.
+type PageTOC struct {
+	Title string
+	URL   string
+	TOC   TOC
+}
+
+// SiteTOC is the table of contents of a whole site, with an entry per page.
+type SiteTOC []*PageTOC
+
+// HTML returns the pages of the site as a "<ul>" list of links, within a
+// `<nav class="site-toc">` element.
+func (s SiteTOC) HTML() template.HTML {
+	if len(s) == 0 {
+		return ""
+	}
+	var buf bytes.Buffer
+	buf.WriteString(`<nav class="site-toc">` + "\n<ul>\n")
+	for _, page := range s {
+		buf.WriteString(`<li><a href="` + template.HTMLEscapeString(page.URL) + `">`)
+		buf.WriteString(template.HTMLEscapeString(page.Title))
+		buf.WriteString("</a></li>\n")
+	}
+	buf.WriteString("</ul>\n</nav>\n")
+	return template.HTML(buf.String())
+}
+
+type tocKey struct{}
+
+// tocCollector collects the table of contents of the Markdown contents of a
+// Page, as they are rendered.
+type tocCollector struct {
+	mu  sync.Mutex
+	toc TOC
+}
+
+// withTOCCollector returns a copy of ctx that carries c.
+func withTOCCollector(ctx context.Context, c *tocCollector) context.Context {
+	return context.WithValue(ctx, tocKey{}, c)
+}
+
+// addTOC adds toc to the tocCollector carried by ctx, if any.
+func addTOC(ctx context.Context, toc TOC) {
+	if c, ok := ctx.Value(tocKey{}).(*tocCollector); ok {
+		c.mu.Lock()
+		c.toc = append(c.toc, toc...)
+		c.mu.Unlock()
+	}
+}
+
+// TOC returns the table of contents of the Markdown, as parsed by the default
+// MarkdownEngine.
+func (m Markdown) TOC() TOC {
+	doc := DefaultMarkdownEngine().md.Parser().Parse(text.NewReader(m))
+	return ExtractTOC(doc, m)
+}
+
+// TOC returns the table of contents of the document.
+func (d *Document) TOC() TOC {
+	return ExtractTOC(d.AST, d.Body)
+}
+
+// KindTOCPlaceholder is the NodeKind of a TOCPlaceholder.
+var KindTOCPlaceholder = ast.NewNodeKind("TOCPlaceholder")
+
+// TOCPlaceholder is a block node that marks where the table of contents of the
+// page goes. It is rendered as "{{toc}}", which Page.Render replaces with the
+// table of contents.
+type TOCPlaceholder struct {
+	ast.BaseBlock
+}
+
+// Kind implements ast.Node.Kind.
+func (n *TOCPlaceholder) Kind() ast.NodeKind {
+	return KindTOCPlaceholder
+}
+
+// Dump implements ast.Node.Dump.
+func (n *TOCPlaceholder) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// tocPlaceholder implements the "{{toc}}" placeholder as a Goldmark extension.
+type tocPlaceholder struct{}
+
+// NewTOCPlaceholder returns a Goldmark extension that turns a paragraph
+// holding only "{{toc}}" into a TOCPlaceholder, so that the table of contents
+// is not rendered within a "<p>" element.
+func NewTOCPlaceholder() goldmark.Extender {
+	return &tocPlaceholder{}
+}
+
+func (e *tocPlaceholder) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(
+		util.Prioritized(e, 500),
+	))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(e, 500),
+	))
+}
+
+// Transform implements parser.ASTTransformer.
+func (e *tocPlaceholder) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	var found []*ast.Paragraph
+	for c := doc.FirstChild(); c != nil; c = c.NextSibling() {
+		para, ok := c.(*ast.Paragraph)
+		if !ok || para.Lines().Len() != 1 {
+			continue
+		}
+		line := para.Lines().At(0)
+		if string(bytes.TrimSpace(line.Value(reader.Source()))) == TOCPlaceholderText {
+			found = append(found, para)
+		}
+	}
+	for _, para := range found {
+		doc.ReplaceChild(doc, para, &TOCPlaceholder{})
+	}
+}
+
+// RegisterFuncs implements renderer.NodeRenderer.
+func (e *tocPlaceholder) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindTOCPlaceholder, func(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			w.WriteString(TOCPlaceholderText + "\n")
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+// Interface guards.
+var _ goldmark.Extender = (*tocPlaceholder)(nil)
+var _ parser.ASTTransformer = (*tocPlaceholder)(nil)
+var _ renderer.NodeRenderer = (*tocPlaceholder)(nil)
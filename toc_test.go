@@ -0,0 +1,104 @@
+package ktw
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	txt "text/template"
+)
+
+const tocdoc = `# Title
+
+## Getting 'started'
+
+### Install
+
+### Say "hi"
+
+## *Usage* {#use}
+
+#### Deep
+
+## Usage
+`
+
+func TestExtractTOC(t *testing.T) {
+	doc, err := ParseDocument([]byte(md(tocdoc)))
+	if err != nil {
+		t.Fatalf("Got error: %+v", err)
+	}
+	want := TOC{
+		{Level: 1, Text: "Title", ID: "title", Children: TOC{
+			{Level: 2, Text: "Getting started", ID: "getting-started", Children: TOC{
+				{Level: 3, Text: "Install", ID: "install"},
+				{Level: 3, Text: "Say “hi”", ID: "say-hi"},
+			}},
+			{Level: 2, Text: "Usage", ID: "use", Children: TOC{
+				{Level: 4, Text: "Deep", ID: "deep"},
+			}},
+			{Level: 2, Text: "Usage", ID: "usage"},
+		}},
+	}
+	if got := doc.TOC(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Got TOC:\n%s\nwant:\n%s", got.HTML(), want.HTML())
+	}
+}
+
+func TestTOCHTML(t *testing.T) {
+	toc := TOC{
+		{Level: 2, Text: "A <b>", ID: "a", Children: TOC{
+			{Level: 3, Text: "B", ID: "b"},
+		}},
+		{Level: 2, Text: "C"},
+	}
+	want := `<nav class="toc">
+<ul>
+<li><a href="#a">A &lt;b&gt;</a>
+<ul>
+<li><a href="#b">B</a></li>
+</ul>
+</li>
+<li>C</li>
+</ul>
+</nav>
+`
+	if got := string(toc.HTML()); got != want {
+		t.Errorf("Got:\n%s\nwant:\n%s", got, want)
+	}
+	if got := TOC(nil).HTML(); got != "" {
+		t.Errorf("Got %q for an empty TOC", got)
+	}
+}
+
+func TestPageTOC(t *testing.T) {
+	ctx := context.Background()
+	tmpl, err := txt.New("").Delims("<<", ">>").Parse(
+		`<ol>{{range .TOC}}<li>{{.Text}}</li>{{end}}</ol>{{sitetoc}}<< .Body >>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pg := &Page{
+		Contents: []Renderer{md("# One\n\n{{toc}}\n\n## Two\n")},
+		Site:     SiteTOC{{Title: "Home", URL: "/index.html"}},
+		Template: tmpl,
+	}
+	var buf bytes.Buffer
+	if err := pg.Render(ctx, &buf); err != nil {
+		t.Fatalf("Got error: %+v", err)
+	}
+	for _, want := range []string{
+		`<ol><li>One</li></ol>`,
+		`<nav class="site-toc">` + "\n<ul>\n" + `<li><a href="/index.html">Home</a></li>`,
+		`<h1 id="one">One</h1>` + "\n" + `<nav class="toc">`,
+		`<li><a href="#two">Two</a></li>`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Output does not contain %q:\n%s", want, buf.String())
+		}
+	}
+	if strings.Contains(buf.String(), "<p>") {
+		t.Errorf("Placeholder rendered within a paragraph:\n%s", buf.String())
+	}
+}